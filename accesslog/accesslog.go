@@ -0,0 +1,282 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpendery/wock/model"
+)
+
+type Format string
+
+const (
+	// FormatCLF is the Common Log Format followed by the host, latency in microseconds, tls
+	// version, and what answered the request
+	FormatCLF  Format = "clf"
+	FormatJSON Format = "json"
+
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	clfEmpty      = "-"
+)
+
+var (
+	errInvalidEntry = errors.New("invalid access log entry")
+)
+
+// Entry is a request served for a wocked host
+type Entry struct {
+	// Time is when the request arrived
+	Time    time.Time     `json:"time"`
+	Host    string        `json:"host"`
+	Remote  string        `json:"remote,omitempty"`
+	Method  string        `json:"method"`
+	Path    string        `json:"path"`
+	Proto   string        `json:"proto,omitempty"`
+	Status  int           `json:"status"`
+	Bytes   int64         `json:"bytes"`
+	Latency time.Duration `json:"latency"`
+	TLS     string        `json:"tls,omitempty"`
+	// Source is the rule that matched the request, e.g. the file served or the upstream
+	Source string `json:"source,omitempty"`
+}
+
+// NewEntry creates the entry for a request that finished at the given time
+func NewEntry(host string, request model.RequestEvent, finished time.Time) Entry {
+	return Entry{
+		Time:    finished.Add(-request.Latency),
+		Host:    host,
+		Remote:  request.Remote,
+		Method:  request.Method,
+		Path:    request.Path,
+		Proto:   request.Proto,
+		Status:  request.Status,
+		Bytes:   request.Bytes,
+		Latency: request.Latency,
+		TLS:     request.TLS,
+		Source:  request.Source,
+	}
+}
+
+func ParseFormat(format string) (Format, error) {
+	switch Format(strings.ToLower(format)) {
+	case FormatCLF:
+		return FormatCLF, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown access log format '%s', expected clf or json", format)
+	}
+}
+
+// Marshal formats the entry as a single line, including the trailing newline
+func (e Entry) Marshal(format Format) ([]byte, error) {
+	if format == FormatJSON {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	bytes := clfEmpty
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %s %d %s %s %d %s %s\n",
+		orEmpty(e.Remote),
+		e.Time.Format(clfTimeFormat),
+		quote(strings.TrimSpace(e.Method+" "+e.Path+" "+e.Proto)),
+		e.Status,
+		bytes,
+		quote(e.Host),
+		e.Latency.Microseconds(),
+		quote(orEmpty(e.TLS)),
+		quote(orEmpty(e.Source)),
+	)
+	return []byte(line), nil
+}
+
+// Parse reads an entry written in either format
+func Parse(line string) (Entry, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return Entry{}, fmt.Errorf("%w: %w", errInvalidEntry, err)
+		}
+		return e, nil
+	}
+	fields, err := splitCLF(line)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(fields) != 11 {
+		return Entry{}, fmt.Errorf("%w: expected 11 fields but found %d", errInvalidEntry, len(fields))
+	}
+	var e Entry
+	if fields[0] != clfEmpty {
+		e.Remote = fields[0]
+	}
+	if e.Time, err = time.Parse(clfTimeFormat, fields[3]); err != nil {
+		return Entry{}, fmt.Errorf("%w: %w", errInvalidEntry, err)
+	}
+	requestLine := strings.Fields(fields[4])
+	if len(requestLine) > 0 {
+		e.Method = requestLine[0]
+	}
+	if len(requestLine) > 1 {
+		e.Path = requestLine[1]
+	}
+	if len(requestLine) > 2 {
+		e.Proto = requestLine[2]
+	}
+	if e.Status, err = strconv.Atoi(fields[5]); err != nil {
+		return Entry{}, fmt.Errorf("%w: invalid status: %w", errInvalidEntry, err)
+	}
+	if fields[6] != clfEmpty {
+		if e.Bytes, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			return Entry{}, fmt.Errorf("%w: invalid bytes: %w", errInvalidEntry, err)
+		}
+	}
+	e.Host = fields[7]
+	latency, err := strconv.ParseInt(fields[8], 10, 64)
+	if err != nil {
+		return Entry{}, fmt.Errorf("%w: invalid latency: %w", errInvalidEntry, err)
+	}
+	e.Latency = time.Duration(latency) * time.Microsecond
+	if fields[9] != clfEmpty {
+		e.TLS = fields[9]
+	}
+	if fields[10] != clfEmpty {
+		e.Source = fields[10]
+	}
+	return e, nil
+}
+
+func orEmpty(s string) string {
+	if s == "" {
+		return clfEmpty
+	}
+	return s
+}
+
+// quote wraps a field in quotes, escaping quotes and backslashes the way apache does
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// splitCLF splits a line into its space separated fields, where quoted and bracketed fields
+// can contain spaces. Brackets only delimit a field when the closing bracket ends it, so ipv6
+// remotes like [::1]:8080 stay a single field.
+func splitCLF(line string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch {
+		case line[i] == ' ':
+			i++
+		case line[i] == '"':
+			var field strings.Builder
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+					if line[i] == 'n' {
+						field.WriteByte('\n')
+						continue
+					}
+				}
+				field.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("%w: unterminated quote", errInvalidEntry)
+			}
+			fields = append(fields, field.String())
+			i++
+		case line[i] == '[' && isBracketField(line[i:]):
+			end := strings.IndexByte(line[i:], ']')
+			fields = append(fields, line[i+1:i+end])
+			i += end + 1
+		default:
+			end := strings.IndexByte(line[i:], ' ')
+			if end == -1 {
+				end = len(line) - i
+			}
+			fields = append(fields, line[i:i+end])
+			i += end
+		}
+	}
+	return fields, nil
+}
+
+func isBracketField(field string) bool {
+	end := strings.IndexByte(field, ']')
+	return end != -1 && (end+1 == len(field) || field[end+1] == ' ')
+}
+
+// StatusRange matches statuses between Min and Max inclusive
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// ParseStatus parses an exact status (e.g. 404) or a class of statuses (e.g. 5xx)
+func ParseStatus(status string) (StatusRange, error) {
+	normalized := strings.ToLower(strings.TrimSpace(status))
+	if class, ok := strings.CutSuffix(normalized, "xx"); ok && len(class) == 1 && class[0] >= '1' && class[0] <= '5' {
+		low := int(class[0]-'0') * 100
+		return StatusRange{Min: low, Max: low + 99}, nil
+	}
+	code, err := strconv.Atoi(normalized)
+	if err != nil || code < 100 || code > 599 {
+		return StatusRange{}, fmt.Errorf("invalid status '%s', expected a status like 404 or a class like 4xx", status)
+	}
+	return StatusRange{Min: code, Max: code}, nil
+}
+
+// Filter selects entries, every set condition has to match
+type Filter struct {
+	// Hosts are host names or globs
+	Hosts    []string
+	Statuses []StatusRange
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f Filter) Match(e Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if len(f.Hosts) != 0 && !f.matchHost(e.Host) {
+		return false
+	}
+	if len(f.Statuses) != 0 && !f.matchStatus(e.Status) {
+		return false
+	}
+	return true
+}
+
+func (f Filter) matchHost(host string) bool {
+	for _, pattern := range f.Hosts {
+		pattern = strings.ToLower(pattern)
+		if ok, _ := path.Match(pattern, host); ok || pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) matchStatus(status int) bool {
+	for _, statusRange := range f.Statuses {
+		if status >= statusRange.Min && status <= statusRange.Max {
+			return true
+		}
+	}
+	return false
+}
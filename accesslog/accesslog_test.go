@@ -0,0 +1,152 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalParseRoundTrip(t *testing.T) {
+	at := time.Date(2024, time.March, 9, 14, 5, 7, 0, time.FixedZone("", -7*60*60))
+	tests := []struct {
+		name  string
+		entry Entry
+		// want is the clf line, without the trailing newline
+		want string
+	}{
+		{
+			name: "every field",
+			entry: Entry{
+				Time: at, Host: "api.example.com", Remote: "127.0.0.1:51234", Method: "GET", Path: "/users/1",
+				Proto: "HTTP/2.0", Status: 200, Bytes: 512, Latency: 1500 * time.Microsecond, TLS: "TLS 1.3", Source: "/srv/api/users/1.json",
+			},
+			want: `127.0.0.1:51234 - - [09/Mar/2024:14:05:07 -0700] "GET /users/1 HTTP/2.0" 200 512 "api.example.com" 1500 "TLS 1.3" "/srv/api/users/1.json"`,
+		},
+		{
+			name:  "placeholders",
+			entry: Entry{Time: at, Host: "app.example.com", Method: "HEAD", Path: "/", Proto: "HTTP/1.1", Status: 304},
+			want:  `- - - [09/Mar/2024:14:05:07 -0700] "HEAD / HTTP/1.1" 304 - "app.example.com" 0 "-" "-"`,
+		},
+		{
+			name:  "ipv6 remote",
+			entry: Entry{Time: at, Host: "app.example.com", Remote: "[::1]:8443", Method: "GET", Path: "/", Proto: "HTTP/1.1", Status: 200, Bytes: 5},
+			want:  `[::1]:8443 - - [09/Mar/2024:14:05:07 -0700] "GET / HTTP/1.1" 200 5 "app.example.com" 0 "-" "-"`,
+		},
+		{
+			name:  "ipv6 remote without port",
+			entry: Entry{Time: at, Host: "app.example.com", Remote: "2001:db8::1", Method: "GET", Path: "/", Proto: "HTTP/1.1", Status: 200, Bytes: 5},
+			want:  `2001:db8::1 - - [09/Mar/2024:14:05:07 -0700] "GET / HTTP/1.1" 200 5 "app.example.com" 0 "-" "-"`,
+		},
+		{
+			name: "quoted fields",
+			entry: Entry{
+				Time: at, Host: "app.example.com", Remote: "127.0.0.1:1", Method: "GET", Path: `/search?q="wock"`,
+				Proto: "HTTP/1.1", Status: 502, Bytes: 11, Source: "http://localhost:5173 \"dev\" \\ server\nsecond line",
+			},
+			want: `127.0.0.1:1 - - [09/Mar/2024:14:05:07 -0700] "GET /search?q=\"wock\" HTTP/1.1" 502 11 "app.example.com" 0 "-" "http://localhost:5173 \"dev\" \\ server\nsecond line"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := tt.entry.Marshal(FormatCLF)
+			if err != nil {
+				t.Fatalf("unable to marshal: %v", err)
+			}
+			if got := strings.TrimSuffix(string(line), "\n"); got != tt.want {
+				t.Errorf("unexpected line\nwant %s\ngot  %s", tt.want, got)
+			}
+			parsed, err := Parse(string(line))
+			if err != nil {
+				t.Fatalf("unable to parse %s: %v", line, err)
+			}
+			if !parsed.Time.Equal(tt.entry.Time) {
+				t.Errorf("expected time %s, got %s", tt.entry.Time, parsed.Time)
+			}
+			parsed.Time = tt.entry.Time
+			if parsed != tt.entry {
+				t.Errorf("round trip changed the entry\nwant %+v\ngot  %+v", tt.entry, parsed)
+			}
+		})
+	}
+}
+
+func TestMarshalParseJSON(t *testing.T) {
+	entry := Entry{
+		Time: time.Date(2024, time.March, 9, 14, 5, 7, 0, time.UTC), Host: "api.example.com", Remote: "[::1]:8443",
+		Method: "POST", Path: "/users", Status: 201, Bytes: 64, Latency: 2 * time.Millisecond, Source: `"quoted"`,
+	}
+	line, err := entry.Marshal(FormatJSON)
+	if err != nil {
+		t.Fatalf("unable to marshal: %v", err)
+	}
+	parsed, err := Parse(string(line))
+	if err != nil {
+		t.Fatalf("unable to parse %s: %v", line, err)
+	}
+	if parsed != entry {
+		t.Errorf("round trip changed the entry\nwant %+v\ngot  %+v", entry, parsed)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{
+		``,
+		`{"time":`,
+		`127.0.0.1 - - [09/Mar/2024:14:05:07 -0700] "GET / HTTP/1.1" 200 5 "app.example.com" 0 "-"`,
+		`127.0.0.1 - - [09/Mar/2024:14:05:07 -0700] "GET / HTTP/1.1 200 5 "app.example.com" 0 "-" "-"`,
+		`127.0.0.1 - - [not a time] "GET / HTTP/1.1" 200 5 "app.example.com" 0 "-" "-"`,
+		`127.0.0.1 - - [09/Mar/2024:14:05:07 -0700] "GET / HTTP/1.1" ok 5 "app.example.com" 0 "-" "-"`,
+	} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("expected an error parsing %q", line)
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		status  string
+		want    StatusRange
+		wantErr bool
+	}{
+		{status: "404", want: StatusRange{Min: 404, Max: 404}},
+		{status: "5xx", want: StatusRange{Min: 500, Max: 599}},
+		{status: " 2XX ", want: StatusRange{Min: 200, Max: 299}},
+		{status: "6xx", wantErr: true},
+		{status: "99", wantErr: true},
+		{status: "teapot", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatus(tt.status)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStatus(%q) returned error %v", tt.status, err)
+		} else if got != tt.want {
+			t.Errorf("ParseStatus(%q) = %+v, want %+v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	at := time.Date(2024, time.March, 9, 14, 0, 0, 0, time.UTC)
+	entry := Entry{Time: at, Host: "api.example.com", Status: 503}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty", filter: Filter{}, want: true},
+		{name: "host", filter: Filter{Hosts: []string{"api.example.com"}}, want: true},
+		{name: "host glob", filter: Filter{Hosts: []string{"*.EXAMPLE.com"}}, want: true},
+		{name: "other host", filter: Filter{Hosts: []string{"app.example.com"}}, want: false},
+		{name: "status class", filter: Filter{Statuses: []StatusRange{{Min: 400, Max: 499}, {Min: 500, Max: 599}}}, want: true},
+		{name: "other status", filter: Filter{Statuses: []StatusRange{{Min: 200, Max: 299}}}, want: false},
+		{name: "within window", filter: Filter{Since: at.Add(-time.Minute), Until: at.Add(time.Minute)}, want: true},
+		{name: "before since", filter: Filter{Since: at.Add(time.Minute)}, want: false},
+		{name: "after until", filter: Filter{Until: at.Add(-time.Minute)}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(entry); got != tt.want {
+			t.Errorf("%s: expected match %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
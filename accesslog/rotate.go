@@ -0,0 +1,235 @@
+package accesslog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeFormat sorts rotated files chronologically by name
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+)
+
+// Rotation limits how large and old the access log gets before it's moved aside, a zero limit
+// disables that kind of rotation
+type Rotation struct {
+	MaxSize int64
+	MaxAge  time.Duration
+	// MaxBackups is how many rotated files are kept, zero keeps all of them
+	MaxBackups int
+}
+
+// Writer appends entries to an access log, rotating it once it reaches the rotation limits
+type Writer struct {
+	path     string
+	format   Format
+	rotation Rotation
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	created  time.Time
+}
+
+// Open opens the access log at the path for appending, creating it if needed
+func Open(path string, format Format, rotation Rotation) (*Writer, error) {
+	w := &Writer{path: path, format: format, rotation: rotation}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create access log directory: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open access log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to open access log: %w", err)
+	}
+	w.file = f
+	w.size = info.Size()
+	w.created = time.Now()
+	if w.size != 0 {
+		// the file's age is measured from its first entry, since files don't record when they were created
+		if first, ok := firstEntry(w.path); ok {
+			w.created = first.Time
+		}
+	}
+	return nil
+}
+
+func firstEntry(path string) (Entry, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Entry{}, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return Entry{}, false
+	}
+	e, err := Parse(scanner.Text())
+	return e, err == nil
+}
+
+// Write appends the entry, rotating the log first when it would exceed the limits
+func (w *Writer) Write(e Entry) error {
+	line, err := e.Marshal(w.format)
+	if err != nil {
+		return fmt.Errorf("unable to format access log entry: %w", err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	if w.shouldRotate(int64(len(line))) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("unable to write access log: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) shouldRotate(next int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.rotation.MaxSize > 0 && w.size+next > w.rotation.MaxSize {
+		return true
+	}
+	return w.rotation.MaxAge > 0 && time.Since(w.created) > w.rotation.MaxAge
+}
+
+// rotate moves the current log aside with the time it was rotated, and drops the oldest backups
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("unable to close access log: %w", err)
+	}
+	w.file = nil
+	backup, err := w.nextBackupPath()
+	if err == nil {
+		err = os.Rename(w.path, backup)
+	}
+	if err != nil {
+		// keep appending to the current log rather than losing entries
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("unable to rotate access log: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	if w.rotation.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := Backups(w.path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > w.rotation.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("unable to remove old access log: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the access log, after which writes fail with os.ErrClosed
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// nextBackupPath names the next rotated log after the current time, moving it past the newest
+// backup when rotations happen within the same millisecond so backups are never overwritten
+func (w *Writer) nextBackupPath() (string, error) {
+	backups, err := Backups(w.path)
+	if err != nil {
+		return "", err
+	}
+	path := backupPath(w.path, time.Now())
+	if len(backups) == 0 || path > backups[len(backups)-1] {
+		return path, nil
+	}
+	newest, err := backupTime(w.path, backups[len(backups)-1])
+	if err != nil {
+		return "", fmt.Errorf("unable to name rotated access log: %w", err)
+	}
+	return backupPath(w.path, newest.Add(time.Millisecond)), nil
+}
+
+// backupTime is when the rotated log was rotated, from its name
+func backupTime(path string, backup string) (time.Time, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+	stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(backup), prefix), ext)
+	return time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+}
+
+// backupPath names a rotated log after the time it was rotated, e.g. access-2006-01-02T15-04-05.000.log
+func backupPath(path string, rotated time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + rotated.Format(backupTimeFormat) + ext
+}
+
+// Backups returns the rotated logs of the access log at the path, oldest first. Only files named
+// like a rotated log are included, so other files in the directory are never pruned.
+func Backups(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to list rotated access logs: %w", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := backupTime(path, name); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(path), name))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Files returns every file of the access log at the path, oldest first
+func Files(path string) ([]string, error) {
+	files, err := Backups(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,223 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(path string, at time.Time) Entry {
+	return Entry{Time: at, Host: "api.example.com", Remote: "127.0.0.1:1", Method: "GET", Path: path, Proto: "HTTP/1.1", Status: 200, Bytes: 2}
+}
+
+// readPaths returns the request paths logged in every file of the access log, oldest first
+func readPaths(t *testing.T, path string) [][]string {
+	t.Helper()
+	files, err := Files(path)
+	if err != nil {
+		t.Fatalf("unable to list access logs: %v", err)
+	}
+	var paths [][]string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unable to read %s: %v", file, err)
+		}
+		var filePaths []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if line == "" {
+				continue
+			}
+			e, err := Parse(line)
+			if err != nil {
+				t.Fatalf("unable to parse %s: %v", line, err)
+			}
+			filePaths = append(filePaths, e.Path)
+		}
+		paths = append(paths, filePaths)
+	}
+	return paths
+}
+
+func TestWriterRotation(t *testing.T) {
+	lineSize := func() int64 {
+		line, _ := testEntry("/0", time.Now()).Marshal(FormatCLF)
+		return int64(len(line))
+	}()
+	tests := []struct {
+		name     string
+		rotation Rotation
+		writes   int
+		want     [][]string
+	}{
+		{
+			name:     "no limits",
+			rotation: Rotation{},
+			writes:   4,
+			want:     [][]string{{"/0", "/1", "/2", "/3"}},
+		},
+		{
+			name:     "size",
+			rotation: Rotation{MaxSize: 2 * lineSize},
+			writes:   5,
+			want:     [][]string{{"/0", "/1"}, {"/2", "/3"}, {"/4"}},
+		},
+		{
+			name:     "size with an entry over the limit",
+			rotation: Rotation{MaxSize: lineSize / 2},
+			writes:   3,
+			want:     [][]string{{"/0"}, {"/1"}, {"/2"}},
+		},
+		{
+			name:     "size pruning backups",
+			rotation: Rotation{MaxSize: lineSize, MaxBackups: 2},
+			writes:   6,
+			want:     [][]string{{"/3"}, {"/4"}, {"/5"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			w, err := Open(path, FormatCLF, tt.rotation)
+			if err != nil {
+				t.Fatalf("unable to open access log: %v", err)
+			}
+			defer w.Close()
+			for i := 0; i < tt.writes; i++ {
+				if err := w.Write(testEntry("/"+string(rune('0'+i)), time.Now())); err != nil {
+					t.Fatalf("unable to write entry %d: %v", i, err)
+				}
+			}
+			if got := readPaths(t, path); !equalPaths(got, tt.want) {
+				t.Errorf("expected files %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriterRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	old, _ := testEntry("/old", time.Now().Add(-2*time.Hour)).Marshal(FormatCLF)
+	if err := os.WriteFile(path, old, 0o644); err != nil {
+		t.Fatalf("unable to write access log: %v", err)
+	}
+	w, err := Open(path, FormatCLF, Rotation{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("unable to open access log: %v", err)
+	}
+	defer w.Close()
+	for _, p := range []string{"/new", "/newer"} {
+		if err := w.Write(testEntry(p, time.Now())); err != nil {
+			t.Fatalf("unable to write entry: %v", err)
+		}
+	}
+	want := [][]string{{"/old"}, {"/new", "/newer"}}
+	if got := readPaths(t, path); !equalPaths(got, want) {
+		t.Errorf("expected files %v, got %v", want, got)
+	}
+}
+
+func TestWriterAgePrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	stale := []string{backupPath(path, time.Now().Add(-3*time.Hour)), backupPath(path, time.Now().Add(-2*time.Hour))}
+	for _, backup := range stale {
+		if err := os.WriteFile(backup, nil, 0o644); err != nil {
+			t.Fatalf("unable to write backup: %v", err)
+		}
+	}
+	old, _ := testEntry("/old", time.Now().Add(-2*time.Hour)).Marshal(FormatCLF)
+	if err := os.WriteFile(path, old, 0o644); err != nil {
+		t.Fatalf("unable to write access log: %v", err)
+	}
+	w, err := Open(path, FormatCLF, Rotation{MaxAge: time.Hour, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("unable to open access log: %v", err)
+	}
+	defer w.Close()
+	if err := w.Write(testEntry("/new", time.Now())); err != nil {
+		t.Fatalf("unable to write entry: %v", err)
+	}
+	backups, err := Backups(path)
+	if err != nil {
+		t.Fatalf("unable to list backups: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %v", backups)
+	}
+	for _, backup := range stale {
+		if backups[0] == backup {
+			t.Errorf("expected the stale backup %s to be pruned", backup)
+		}
+	}
+}
+
+func TestNextBackupPathKeepsOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	future := backupPath(path, time.Now().Add(time.Hour))
+	if err := os.WriteFile(future, nil, 0o644); err != nil {
+		t.Fatalf("unable to write backup: %v", err)
+	}
+	w := &Writer{path: path}
+	next, err := w.nextBackupPath()
+	if err != nil {
+		t.Fatalf("unable to name backup: %v", err)
+	}
+	if next <= future {
+		t.Errorf("expected %s to sort after %s", next, future)
+	}
+}
+
+func equalPaths(a [][]string, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.Join(a[i], ",") != strings.Join(b[i], ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBackupsIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	backup := backupPath(path, time.Now())
+	for _, name := range []string{filepath.Base(backup), "access-notes.log", "access-2024-01-02.log", "access-.log", "other-2024-01-02T15-04-05.000.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+	}
+	backups, err := Backups(path)
+	if err != nil {
+		t.Fatalf("unable to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0] != backup {
+		t.Errorf("expected only %s, got %v", backup, backups)
+	}
+}
+
+func TestRotationKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	notes := filepath.Join(dir, "access-notes.log")
+	if err := os.WriteFile(notes, []byte("keep me"), 0o644); err != nil {
+		t.Fatalf("unable to write notes: %v", err)
+	}
+	w, err := Open(path, FormatCLF, Rotation{MaxSize: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("unable to open access log: %v", err)
+	}
+	defer w.Close()
+	for i := 0; i < 4; i++ {
+		if err := w.Write(testEntry("/"+string(rune('0'+i)), time.Now())); err != nil {
+			t.Fatalf("unable to write entry %d: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("expected %s to be kept: %v", notes, err)
+	}
+}
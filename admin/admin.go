@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/cpendery/wock/pipe"
+)
+
+const (
+	wockDaemonVariable = "WOCK_DAEMON"
+)
+
+// RunDetached re-executes the cli as the current user to host a rootless daemon, returning once
+// the daemon is accepting connections
+func RunDetached() {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), wockDaemonVariable+"=1")
+	if err := cmd.Start(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	timeout := 30 * time.Second
+	conn, err := pipe.DialServer(&timeout)
+	if err != nil {
+		fmt.Println(err)
+		cmd.Process.Kill()
+		return
+	}
+	conn.Close()
+	cmd.Process.Release()
+}
+
+// IsDetached reports whether this process was spawned by RunDetached to host the daemon
+func IsDetached() bool {
+	return os.Getenv(wockDaemonVariable) != ""
+}
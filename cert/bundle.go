@@ -0,0 +1,69 @@
+package cert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/cpendery/mkcert"
+)
+
+var (
+	WockCABundleFile = filepath.Join(xdg.CacheHome, "wock", "ca-bundle.pem")
+	// systemBundleFiles are where the common linux distros and MacOS keep their trusted roots
+	systemBundleFiles = []string{
+		"/etc/ssl/certs/ca-certificates.crt",
+		"/etc/pki/tls/certs/ca-bundle.crt",
+		"/etc/ssl/ca-bundle.pem",
+		"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+		"/etc/ssl/cert.pem",
+	}
+)
+
+// CAFile returns the path of the local CA's certificate
+func CAFile() (string, error) {
+	setupLogging()
+	defer tearDownLogging()
+	ca := mkcert.MKCert{
+		EnabledStores: enabledStores,
+	}
+	if err := ca.Load(); err != nil {
+		return "", fmt.Errorf("unable to load local CA: %w", err)
+	}
+	return filepath.Join(ca.CAROOT, rootCertName), nil
+}
+
+// WriteBundle writes the system's trusted roots together with the local CA, for tools that only
+// accept a single CA bundle, and reports whether the system's roots were found
+func WriteBundle() (string, bool, error) {
+	caFile, err := CAFile()
+	if err != nil {
+		return "", false, err
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read local CA: %w", err)
+	}
+	var bundle bytes.Buffer
+	foundSystem := false
+	for _, f := range systemBundleFiles {
+		roots, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		bundle.Write(bytes.TrimSpace(roots))
+		bundle.WriteString("\n")
+		foundSystem = true
+		break
+	}
+	bundle.Write(ca)
+	if err := os.MkdirAll(filepath.Dir(WockCABundleFile), 0770); err != nil {
+		return "", false, fmt.Errorf("unable to create CA bundle directory: %w", err)
+	}
+	if err := os.WriteFile(WockCABundleFile, bundle.Bytes(), 0644); err != nil {
+		return "", false, fmt.Errorf("unable to write CA bundle: %w", err)
+	}
+	return WockCABundleFile, foundSystem, nil
+}
@@ -14,7 +14,9 @@ import (
 )
 
 var (
-	enabledStores  = []string{"system", "nss"}
+	enabledStores = []string{"system", "nss"}
+	// certificates were written to disk before they were minted in memory per host, these
+	// are only kept around to clean them up
 	WockCertFile   = filepath.Join(xdg.CacheHome, "wock", "cert.pem")
 	WockKeyFile    = filepath.Join(xdg.CacheHome, "wock", "key.pem")
 	logger         = log.New(os.Stdout, "", 0)
@@ -103,12 +105,3 @@ func Uninstall() error {
 	logger.Println("Successfully uninstalled local CA")
 	return nil
 }
-
-func CreateCert(hosts []string) error {
-	cert := mkcert.MKCert{
-		CertFile:      WockCertFile,
-		KeyFile:       WockKeyFile,
-		EnabledStores: enabledStores,
-	}
-	return cert.Run(hosts)
-}
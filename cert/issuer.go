@@ -0,0 +1,210 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cpendery/mkcert"
+)
+
+const (
+	rootCertName = "rootCA.pem"
+	rootKeyName  = "rootCA-key.pem"
+	// leaf certificates are reissued this long before they expire
+	renewBefore = 24 * time.Hour
+)
+
+// Issuer mints leaf certificates for wocked hosts from the local CA and keeps them in memory,
+// so hosts can be added and removed without touching the certificates served for the others
+type Issuer struct {
+	// Issued is called whenever a certificate is minted, when set. It's called while the issuer
+	// is locked, so it can't use the issuer.
+	Issued func(host string, leaf *x509.Certificate)
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+	lock   sync.Mutex
+	certs  map[string]*tls.Certificate
+}
+
+func NewIssuer() (*Issuer, error) {
+	setupLogging()
+	defer tearDownLogging()
+	ca := mkcert.MKCert{
+		EnabledStores: enabledStores,
+	}
+	if err := ca.Load(); err != nil {
+		return nil, fmt.Errorf("unable to load local CA: %w", err)
+	}
+	caCert, err := readPEM(filepath.Join(ca.CAROOT, rootCertName), "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	parsedCert, err := x509.ParseCertificate(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA certificate: %w", err)
+	}
+	caKey, err := readPEM(filepath.Join(ca.CAROOT, rootKeyName), "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	parsedKey, err := x509.ParsePKCS8PrivateKey(caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA key: %w", err)
+	}
+	signer, ok := parsedKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA key can't sign certificates")
+	}
+	return &Issuer{
+		caCert: parsedCert,
+		caKey:  signer,
+		certs:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// NewEphemeralIssuer creates an issuer backed by a throwaway CA that only lives in memory, for
+// tests that shouldn't depend on the local CA being installed
+func NewEphemeralIssuer() (*Issuer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate CA key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"wock ephemeral CA"},
+			CommonName:   "wock ephemeral CA",
+		},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().AddDate(0, 0, 1),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CA certificate: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA certificate: %w", err)
+	}
+	return &Issuer{
+		caCert: caCert,
+		caKey:  key,
+		certs:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// CA returns the certificate of the CA the issuer mints certificates from
+func (i *Issuer) CA() *x509.Certificate {
+	return i.caCert
+}
+
+func readPEM(path string, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("unable to decode %s", path)
+	}
+	return block.Bytes, nil
+}
+
+// Certificate returns the cached certificate for the host, minting a new one if the host
+// hasn't been seen yet or its certificate is about to expire
+func (i *Issuer) Certificate(host string) (*tls.Certificate, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if certificate, ok := i.certs[host]; ok && time.Until(certificate.Leaf.NotAfter) > renewBefore {
+		return certificate, nil
+	}
+	certificate, err := i.mint(host)
+	if err != nil {
+		return nil, err
+	}
+	i.certs[host] = certificate
+	if i.Issued != nil {
+		i.Issued(host, certificate.Leaf)
+	}
+	return certificate, nil
+}
+
+// Forget drops the cached certificate for a host that is no longer wocked
+func (i *Issuer) Forget(host string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.certs, host)
+}
+
+// Expiry returns when the certificate served for the host expires, if one has been minted
+func (i *Issuer) Expiry(host string) (time.Time, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	certificate, ok := i.certs[host]
+	if !ok {
+		return time.Time{}, false
+	}
+	return certificate.Leaf.NotAfter, true
+}
+
+func (i *Issuer) mint(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate certificate key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %w", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"wock development certificate"},
+		},
+		NotBefore: time.Now(),
+		// matches mkcert, staying under the 825 day limit macOS applies to all certificates
+		NotAfter:    time.Now().AddDate(2, 3, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tpl.IPAddresses = []net.IP{ip}
+	} else {
+		tpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, i.caCert, key.Public(), i.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create certificate for %s: %w", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate for %s: %w", host, err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
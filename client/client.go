@@ -1,187 +1,565 @@
+// Package client drives the wock daemon over its socket, the same way the wock cli does.
+//
+//	c, err := client.NewClient(ctx)
+//	if errors.Is(err, client.ErrDaemonOffline) {
+//		// start the daemon with `wock start`
+//	}
+//	defer c.Close()
+//	err = c.Mock(ctx, model.MockMessageData{Host: "app.example.com", Upstream: "http://localhost:3000"})
+//
+// Requests are safe to make concurrently. Requests without a deadline on their context give up
+// after 10 seconds, and errors reported by the daemon match the package's sentinel errors with
+// errors.Is.
 package client
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/cpendery/wock/model"
 	"github.com/cpendery/wock/pipe"
+	"github.com/cpendery/wock/version"
 	"github.com/google/uuid"
 )
 
 const (
-	clientTimeout = 5 * time.Second
-)
-
-var (
-	ErrUnableToDialDaemon = errors.New("unable to dial daemon")
+	defaultTimeout = 10 * time.Second
+	dialTimeout    = 1 * time.Second
+	// daemons from before the handshake never answer it, so it can't wait as long as other requests
+	handshakeTimeout = 2 * time.Second
+	// eventBuffer is how many events a subscriber can fall behind before events are dropped
+	eventBuffer = 256
 )
 
+// Client talks to the daemon over a single connection, responses are matched to requests by id
+// so requests can safely be made concurrently
 type Client struct {
-	server   net.Conn
-	incoming net.Listener
-	clientId string
-	received chan model.Message
+	conn      net.Conn
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	pending   map[string]chan model.Message
+	streams   map[string]chan model.Event
+	done      chan struct{}
+	err       error
+	timeout   time.Duration
+
+	daemonVersion string
+}
+
+type options struct {
+	socketPath string
+	timeout    time.Duration
+}
+
+// Option configures how a client connects to the daemon
+type Option func(*options)
+
+// WithSocketPath connects to a daemon listening somewhere other than the default socket, or named
+// pipe on Windows
+func WithSocketPath(path string) Option {
+	return func(o *options) {
+		o.socketPath = path
+	}
 }
 
-func NewClient() (*Client, error) {
-	clientId := uuid.NewString()
-	serverConnection, err := pipe.DialServer(nil)
+// WithTimeout changes how long requests without a deadline on their context wait for the daemon
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// NewClient connects to the daemon, checking that it speaks the same protocol version. It returns
+// ErrDaemonOffline when no daemon is running, and a *VersionMismatchError when the daemon was
+// started by an incompatible version of wock.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	client, err := dial(ctx, opts)
 	if err != nil {
-		slog.Debug("unable to dial daemon", slog.String("error", err.Error()))
-		return nil, ErrUnableToDialDaemon
+		return nil, err
+	}
+	if err := client.handshake(ctx); err != nil {
+		client.Close()
+		return nil, err
 	}
-	incomingListener, err := pipe.ClientListen(clientId)
+	return client, nil
+}
+
+func dial(ctx context.Context, opts []Option) (*Client, error) {
+	o := options{socketPath: pipe.Path(), timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := pipe.DialContext(dialCtx, o.socketPath)
 	if err != nil {
-		slog.Debug("unable to listen to client pipe", slog.String("error", err.Error()))
-		return nil, errors.New("unable to listen to client pipe")
+		slog.Debug("unable to dial daemon", slog.String("error", err.Error()))
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, fmt.Errorf("unable to connect to the daemon at %s: %w", o.socketPath, ErrPermissionDenied)
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrDaemonOffline
 	}
 	client := Client{
-		server:   serverConnection,
-		incoming: incomingListener,
-		clientId: clientId,
-		received: make(chan model.Message, 2),
+		conn:    conn,
+		pending: make(map[string]chan model.Message),
+		streams: make(map[string]chan model.Event),
+		done:    make(chan struct{}),
+		timeout: o.timeout,
 	}
 	go client.readIncomingMessages()
 	return &client, nil
 }
 
-func (c *Client) Close() error {
-	if err := c.server.Close(); err != nil {
-		return fmt.Errorf("failed to close daemon pipe: %w", err)
+func (c *Client) handshake(ctx context.Context) error {
+	hello, err := json.Marshal(model.HelloMessageData{Version: version.Get(), Protocol: model.ProtocolVersion})
+	if err != nil {
+		return fmt.Errorf("unable to create hello message: %w", err)
 	}
-	if err := c.incoming.Close(); err != nil {
-		return fmt.Errorf("failed to close daemon pipe: %w", err)
+	handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	resp, err := c.request(handshakeCtx, model.HelloMessage, hello)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		slog.Debug("daemon didn't answer the handshake", slog.String("error", err.Error()))
+		return ErrLegacyDaemon
+	}
+	var daemonHello model.HelloMessageData
+	if resp.MsgType != model.SuccessMessage || json.Unmarshal(resp.Data, &daemonHello) != nil {
+		return ErrLegacyDaemon
+	}
+	c.daemonVersion = daemonHello.Version
+	if daemonHello.Protocol != model.ProtocolVersion {
+		return &VersionMismatchError{DaemonVersion: daemonHello.Version, DaemonProtocol: daemonHello.Protocol}
 	}
 	return nil
 }
 
-func (c *Client) SendMessage(msgType model.MessageType, data []byte) error {
-	msg, err := json.Marshal(&model.Message{MsgType: msgType, Data: data, ClientId: c.clientId})
+// DaemonVersion is the version of wock the daemon is running
+func (c *Client) DaemonVersion() string {
+	return c.daemonVersion
+}
+
+// StopDaemon stops the daemon even when it was started by another version of wock, so it can still
+// be replaced. Daemons from before the handshake are sent their own unframed stop message.
+func StopDaemon(ctx context.Context, opts ...Option) error {
+	c, err := dial(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("unable to marshal message: %w", err)
+		return err
 	}
-	if _, err := c.server.Write(msg); err != nil {
-		return fmt.Errorf("unable to write message %s: %w", string(msg), err)
+	defer c.Close()
+	var mismatch *VersionMismatchError
+	if err := c.handshake(ctx); errors.Is(err, ErrLegacyDaemon) {
+		slog.Debug("stopping legacy daemon")
+		return stopLegacyDaemon(ctx, opts)
+	} else if err != nil && !errors.As(err, &mismatch) {
+		return err
 	}
-	if _, err := c.server.Write([]byte("\n")); err != nil {
-		return fmt.Errorf("unable to write message delimiter: %w", err)
+	return c.Stop(ctx)
+}
+
+// responseError turns an error response into a *DaemonError, falling back to the raw response data
+// for daemons that don't send structured errors
+func responseError(resp model.Message, fallback string) error {
+	if resp.MsgType != model.ErrorMessage {
+		return errors.New(fallback)
 	}
-	go func() {
-		time.Sleep(clientTimeout)
-		c.received <- model.Message{MsgType: model.TimeoutMessage}
-	}()
+	var data model.ErrorMessageData
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.Message == "" {
+		return &DaemonError{Code: model.ErrorCodeInternal, Message: string(resp.Data)}
+	}
+	return &DaemonError{Code: data.Code, Message: data.Message}
+}
+
+// Close closes the connection to the daemon, failing any requests still waiting on a response
+func (c *Client) Close() error {
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("failed to close daemon pipe: %w", err)
+	}
+	<-c.done
 	return nil
 }
 
-func (c *Client) readIncomingMessages() {
-	conn, err := c.incoming.Accept()
+// SendMessage sends a raw request to the daemon and waits for its response, giving up after the
+// client's timeout when the context has no deadline
+func (c *Client) SendMessage(ctx context.Context, msgType model.MessageType, data []byte) (model.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return c.request(ctx, msgType, data)
+}
+
+func (c *Client) request(ctx context.Context, msgType model.MessageType, data []byte) (model.Message, error) {
+	return c.requestWithID(ctx, uuid.NewString(), msgType, data)
+}
+
+func (c *Client) requestWithID(ctx context.Context, id string, msgType model.MessageType, data []byte) (model.Message, error) {
+	received := make(chan model.Message, 1)
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return model.Message{}, c.err
+	}
+	c.pending[id] = received
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		delete(c.pending, id)
+		c.lock.Unlock()
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return model.Message{}, err
+	}
+	c.writeLock.Lock()
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	err := model.WriteMessage(c.conn, model.Message{Id: id, MsgType: msgType, Data: data})
+	c.writeLock.Unlock()
 	if err != nil {
-		slog.Error("failed to accept incoming connection", slog.String("error", err.Error()))
-		os.Exit(1)
+		// the frame may have been partially written, leaving the connection unusable
+		c.conn.Close()
+		if ctx.Err() != nil {
+			return model.Message{}, ctx.Err()
+		}
+		return model.Message{}, err
 	}
-	defer conn.Close()
-	reader := bufio.NewReader(conn)
+
+	select {
+	case resp := <-received:
+		return resp, nil
+	case <-c.done:
+		// the daemon can close the connection right after responding, as it does when stopping
+		select {
+		case resp := <-received:
+			return resp, nil
+		default:
+			return model.Message{}, c.err
+		}
+	case <-ctx.Done():
+		return model.Message{}, fmt.Errorf("no response from daemon: %w", ctx.Err())
+	}
+}
+
+func (c *Client) readIncomingMessages() {
+	var err error
 	for {
-		data, err := reader.ReadBytes('\n')
-		if err != nil {
-			if err != io.EOF {
-				slog.Error("failed to read incoming message", slog.String("error", err.Error()))
-			}
+		var msg model.Message
+		// responses from another protocol version are passed along for the handshake to reject
+		if msg, err = model.ReadMessage(c.conn); err != nil && !errors.Is(err, model.ErrUnsupportedVersion) {
 			break
 		}
-		var msg model.Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			slog.Error("failed to unmarshal message", slog.String("error", err.Error()), slog.String("message", string(data)))
+		if msg.MsgType == model.EventMessage {
+			c.routeEvent(msg)
+			continue
+		}
+		c.lock.Lock()
+		received, ok := c.pending[msg.Id]
+		c.lock.Unlock()
+		if !ok {
+			slog.Debug("dropping response to a request that was abandoned", slog.String("id", msg.Id))
+			continue
 		}
-		c.received <- msg
+		received <- msg
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		c.err = ErrConnectionClosed
+	} else {
+		c.err = fmt.Errorf("unable to read response: %w", err)
+	}
+	close(c.done)
+}
+
+// routeEvent passes an event along to its subscription, dropping it if the subscriber has fallen
+// too far behind
+func (c *Client) routeEvent(msg model.Message) {
+	c.lock.Lock()
+	events, ok := c.streams[msg.Id]
+	c.lock.Unlock()
+	if !ok {
+		return
+	}
+	var event model.Event
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		slog.Debug("dropping invalid event", slog.String("error", err.Error()))
+		return
+	}
+	select {
+	case events <- event:
+	default:
+		slog.Debug("dropping event for slow subscriber", slog.String("type", string(event.Type)))
 	}
 }
 
-func (c *Client) CheckStatus() (*[]model.MockedHost, error) {
-	if err := c.SendMessage(model.StatusMessage, []byte{}); err != nil {
+// Subscribe streams the daemon's events, starting with its listeners. The channel is closed when
+// the context is done or the connection to the daemon closes, e.g. when the daemon stops.
+func (c *Client) Subscribe(ctx context.Context) (<-chan model.Event, error) {
+	id := uuid.NewString()
+	received := make(chan model.Event, eventBuffer)
+	c.lock.Lock()
+	c.streams[id] = received
+	c.lock.Unlock()
+	unsubscribe := func() {
+		c.lock.Lock()
+		delete(c.streams, id)
+		c.lock.Unlock()
+	}
+
+	ackCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ackCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	resp, err := c.requestWithID(ackCtx, id, model.SubscribeMessage, []byte{})
+	if err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("unable to send subscribe message: %w", err)
+	}
+	if resp.MsgType != model.SuccessMessage {
+		unsubscribe()
+		return nil, responseError(resp, "subscribe request failed")
+	}
+
+	events := make(chan model.Event)
+	go func() {
+		defer close(events)
+		defer unsubscribe()
+		for {
+			select {
+			case event := <-received:
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				// pass along the events that arrived before the connection closed
+				for {
+					select {
+					case event := <-received:
+						select {
+						case events <- event:
+						case <-ctx.Done():
+							return
+						}
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Status reports the daemon's listeners and every host it's wocking
+func (c *Client) Status(ctx context.Context) (*model.DaemonStatus, error) {
+	resp, err := c.SendMessage(ctx, model.StatusMessage, []byte{})
+	if err != nil {
 		return nil, fmt.Errorf("unable to send status message: %w", err)
 	}
-	resp := <-c.received
 
 	switch resp.MsgType {
 	case model.SuccessMessage:
-		var hosts []model.MockedHost
-		err := json.Unmarshal(resp.Data, &hosts)
+		var status model.DaemonStatus
+		err := json.Unmarshal(resp.Data, &status)
 		if err != nil {
 			return nil, fmt.Errorf("unable to read status response: %w", err)
 		}
-		return &hosts, nil
+		return &status, nil
+	default:
+		return nil, responseError(resp, "status request failed")
+	}
+}
+
+// StartProxy starts the daemon's forward proxy if it isn't running yet, returning the daemon's
+// status with the proxy's listeners
+func (c *Client) StartProxy(ctx context.Context) (*model.DaemonStatus, error) {
+	resp, err := c.SendMessage(ctx, model.ProxyMessage, []byte{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to send proxy message: %w", err)
+	}
+
+	switch resp.MsgType {
+	case model.SuccessMessage:
+		var status model.DaemonStatus
+		err := json.Unmarshal(resp.Data, &status)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read proxy response: %w", err)
+		}
+		return &status, nil
+	default:
+		return nil, responseError(resp, "proxy request failed")
+	}
+}
+
+// APIToken returns the token the daemon's admin api authenticates requests with
+func (c *Client) APIToken(ctx context.Context) (string, error) {
+	resp, err := c.SendMessage(ctx, model.APITokenMessage, []byte{})
+	if err != nil {
+		return "", fmt.Errorf("unable to send api token message: %w", err)
+	}
+
+	switch resp.MsgType {
+	case model.SuccessMessage:
+		var token model.APITokenMessageData
+		if err := json.Unmarshal(resp.Data, &token); err != nil {
+			return "", fmt.Errorf("unable to read api token response: %w", err)
+		}
+		return token.Token, nil
 	default:
-		return nil, errors.New("status request failed")
+		return "", responseError(resp, "api token request failed")
 	}
 }
 
-func (c *Client) Mock(host string, directory string) error {
-	mockMessage, err := json.Marshal(model.MockMessageData{Host: host, Directory: directory})
+// Mock starts wocking a host, serving it from a directory or an upstream, replacing any previous
+// mock of the host
+func (c *Client) Mock(ctx context.Context, mock model.MockMessageData) error {
+	mockMessage, err := json.Marshal(mock)
 	if err != nil {
 		return fmt.Errorf("unable to create mock message: %w", err)
 	}
-	if err := c.SendMessage(model.MockMessage, mockMessage); err != nil {
+	resp, err := c.SendMessage(ctx, model.MockMessage, mockMessage)
+	if err != nil {
 		return fmt.Errorf("unable to send mock message: %w", err)
 	}
-	resp := <-c.received
 
 	switch resp.MsgType {
 	case model.SuccessMessage:
 		return nil
 	default:
-		return errors.New("mock request failed")
+		return responseError(resp, "mock request failed")
 	}
 }
 
-func (c *Client) Clear() error {
-	if err := c.SendMessage(model.ClearMessage, []byte{}); err != nil {
+// Clear stops wocking every host
+func (c *Client) Clear(ctx context.Context) error {
+	resp, err := c.SendMessage(ctx, model.ClearMessage, []byte{})
+	if err != nil {
 		return fmt.Errorf("unable to send clear message: %w", err)
 	}
-	resp := <-c.received
 
 	switch resp.MsgType {
 	case model.SuccessMessage:
 		return nil
 	default:
-		return errors.New("clear request failed")
+		return responseError(resp, "clear request failed")
 	}
 }
 
-func (c *Client) Stop() error {
-	if err := c.SendMessage(model.StopMessage, []byte{}); err != nil {
+// Stop shuts the daemon down, after which the client can't be used
+func (c *Client) Stop(ctx context.Context) error {
+	resp, err := c.SendMessage(ctx, model.StopMessage, []byte{})
+	if err != nil {
 		return fmt.Errorf("unable to send stop message: %w", err)
 	}
-	resp := <-c.received
 
 	switch resp.MsgType {
 	case model.SuccessMessage:
 		return nil
 	default:
-		return errors.New("stop request failed")
+		return responseError(resp, "stop request failed")
 	}
 }
 
-func (c *Client) Remove(host string) error {
-	if err := c.SendMessage(model.UnmockMessage, []byte(host)); err != nil {
-		return fmt.Errorf("unable to send remove message: %w", err)
+// Remove stops wocking the given hosts, globs, and HAR files, returning the hosts that were removed.
+// It returns ErrHostNotMocked when nothing matches.
+func (c *Client) Remove(ctx context.Context, hosts ...string) ([]string, error) {
+	unmockMessage, err := json.Marshal(model.UnmockMessageData{Hosts: hosts})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create remove message: %w", err)
+	}
+	resp, err := c.SendMessage(ctx, model.UnmockMessage, unmockMessage)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send remove message: %w", err)
+	}
+
+	switch resp.MsgType {
+	case model.SuccessMessage:
+		var removed []string
+		if err := json.Unmarshal(resp.Data, &removed); err != nil {
+			return nil, fmt.Errorf("unable to read remove response: %w", err)
+		}
+		return removed, nil
+	default:
+		return nil, responseError(resp, "remove request failed")
+	}
+}
+
+// Replay serves every host in a HAR file from its recorded responses, returning the hosts
+func (c *Client) Replay(ctx context.Context, harFile string, matchBody bool) ([]string, error) {
+	replayMessage, err := json.Marshal(model.ReplayMessageData{Har: harFile, MatchBody: matchBody})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create replay message: %w", err)
+	}
+	resp, err := c.SendMessage(ctx, model.ReplayMessage, replayMessage)
+	if err != nil {
+		return nil, fmt.Errorf("unable to send replay message: %w", err)
+	}
+
+	switch resp.MsgType {
+	case model.SuccessMessage:
+		var hosts []string
+		if err := json.Unmarshal(resp.Data, &hosts); err != nil {
+			return nil, fmt.Errorf("unable to read replay response: %w", err)
+		}
+		return hosts, nil
+	default:
+		return nil, responseError(resp, "replay request failed")
+	}
+}
+
+// Throttle adds latency and bandwidth limits to a wocked host
+func (c *Client) Throttle(ctx context.Context, host string, throttle model.Throttle) error {
+	throttleMessage, err := json.Marshal(model.ThrottleMessageData{Host: host, Throttle: throttle})
+	if err != nil {
+		return fmt.Errorf("unable to create throttle message: %w", err)
+	}
+	resp, err := c.SendMessage(ctx, model.ThrottleMessage, throttleMessage)
+	if err != nil {
+		return fmt.Errorf("unable to send throttle message: %w", err)
+	}
+
+	switch resp.MsgType {
+	case model.SuccessMessage:
+		return nil
+	default:
+		return responseError(resp, "throttle request failed")
+	}
+}
+
+// Fault injects errors and dropped connections into a wocked host's responses
+func (c *Client) Fault(ctx context.Context, host string, faults model.FaultProfile) error {
+	faultMessage, err := json.Marshal(model.FaultMessageData{Host: host, Faults: faults})
+	if err != nil {
+		return fmt.Errorf("unable to create fault message: %w", err)
+	}
+	resp, err := c.SendMessage(ctx, model.FaultMessage, faultMessage)
+	if err != nil {
+		return fmt.Errorf("unable to send fault message: %w", err)
 	}
-	resp := <-c.received
 
 	switch resp.MsgType {
 	case model.SuccessMessage:
 		return nil
-	case model.ErrorMessage:
-		return errors.New(string(resp.Data))
 	default:
-		return errors.New("remove request failed")
+		return responseError(resp, "fault request failed")
 	}
 }
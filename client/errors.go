@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/version"
+)
+
+var (
+	// ErrDaemonOffline is returned when no daemon is listening on the socket
+	ErrDaemonOffline = errors.New("wock daemon is offline")
+	// ErrPermissionDenied is returned when the current user can't connect to the daemon, or the
+	// daemon lacks the privileges to carry out a request, e.g. to edit the hosts file
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrHostNotMocked is returned when a request targets a host the daemon isn't wocking
+	ErrHostNotMocked      = errors.New("host is not being wocked")
+	ErrConnectionClosed   = errors.New("connection to daemon closed")
+	ErrLegacyDaemon       = errors.New("wock daemon is from a version of wock that doesn't support version negotiation, run `wock restart` to replace it")
+	ErrUnsupportedRequest = errors.New("wock daemon doesn't support the request")
+)
+
+// DaemonError is an error reported by the daemon while handling a request. It matches the
+// package's sentinel errors with errors.Is, e.g. errors.Is(err, client.ErrHostNotMocked).
+type DaemonError struct {
+	Code    model.ErrorCode
+	Message string
+}
+
+func (e *DaemonError) Error() string {
+	return e.Message
+}
+
+func (e *DaemonError) Is(target error) bool {
+	switch target {
+	case ErrHostNotMocked:
+		return e.Code == model.ErrorCodeHostNotMocked
+	case ErrPermissionDenied:
+		return e.Code == model.ErrorCodePermissionDenied
+	case ErrUnsupportedRequest:
+		return e.Code == model.ErrorCodeUnknownMessageType || e.Code == model.ErrorCodeUnsupportedProtocol
+	}
+	return false
+}
+
+// VersionMismatchError is returned when the daemon speaks a different protocol version than the
+// client, in which case it has to be restarted with the client's version of wock
+type VersionMismatchError struct {
+	DaemonVersion  string
+	DaemonProtocol uint8
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("wock daemon is running version %s with protocol %d, but this is version %s with protocol %d", e.DaemonVersion, e.DaemonProtocol, version.Get(), model.ProtocolVersion)
+}
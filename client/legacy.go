@@ -0,0 +1,91 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/pipe"
+	"github.com/google/uuid"
+)
+
+// legacyMessage is the newline delimited message daemons from before the handshake read. They
+// answer on a connection of their own to the socket named by the client id.
+type legacyMessage struct {
+	MsgType  model.MessageType `json:"msgType"`
+	ClientId string            `json:"clientId,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+}
+
+// stopLegacyDaemon stops a daemon from before the handshake with its own message format
+func stopLegacyDaemon(ctx context.Context, opts []Option) error {
+	o := options{socketPath: pipe.Path(), timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	clientId := uuid.NewString()
+	listener, err := pipe.LegacyClientListen(o.socketPath, clientId)
+	if err != nil {
+		return fmt.Errorf("unable to listen for the legacy daemon's response: %w", err)
+	}
+	defer listener.Close()
+	conn, err := pipe.DialContext(ctx, o.socketPath)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the legacy daemon: %w", err)
+	}
+	defer conn.Close()
+	stop, err := json.Marshal(legacyMessage{MsgType: model.StopMessage, ClientId: clientId})
+	if err != nil {
+		return fmt.Errorf("unable to create stop message: %w", err)
+	}
+	if _, err := conn.Write(append(stop, '\n')); err != nil {
+		return fmt.Errorf("unable to send stop message: %w", err)
+	}
+
+	responses := make(chan legacyMessage, 1)
+	errs := make(chan error, 1)
+	go func() {
+		resp, err := readLegacyResponse(listener)
+		if err != nil {
+			errs <- err
+			return
+		}
+		responses <- resp
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("unable to stop the legacy daemon: %w", ctx.Err())
+	case err := <-errs:
+		return fmt.Errorf("unable to read the legacy daemon's response: %w", err)
+	case resp := <-responses:
+		if resp.MsgType != model.SuccessMessage {
+			return fmt.Errorf("stop request failed: %s", resp.Data)
+		}
+		return nil
+	}
+}
+
+func readLegacyResponse(listener net.Listener) (legacyMessage, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return legacyMessage{}, err
+	}
+	defer conn.Close()
+	data, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return legacyMessage{}, err
+	}
+	var resp legacyMessage
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return legacyMessage{}, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+//go:build !windows
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cpendery/wock/model"
+)
+
+// serveLegacyDaemon fakes a daemon from before the handshake, which reads newline delimited
+// messages and answers on a connection to the client's own socket. The stop messages it receives
+// are sent on the returned channel.
+func serveLegacyDaemon(t *testing.T, path string) <-chan legacyMessage {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("unable to listen on %s: %v", path, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	stops := make(chan legacyMessage, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					data, err := reader.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					var msg legacyMessage
+					if json.Unmarshal(data, &msg) != nil || msg.MsgType != model.StopMessage {
+						continue
+					}
+					client, err := net.Dial("unix", path+"-"+msg.ClientId)
+					if err != nil {
+						t.Errorf("unable to dial the client's socket: %v", err)
+						return
+					}
+					resp, _ := json.Marshal(legacyMessage{MsgType: model.SuccessMessage})
+					client.Write(append(resp, '\n'))
+					client.Close()
+					stops <- msg
+				}
+			}()
+		}
+	}()
+	return stops
+}
+
+func TestStopDaemonLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wock")
+	stops := serveLegacyDaemon(t, path)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := NewClient(ctx, WithSocketPath(path)); err != ErrLegacyDaemon {
+		t.Fatalf("expected %v, got %v", ErrLegacyDaemon, err)
+	}
+	if err := StopDaemon(ctx, WithSocketPath(path)); err != nil {
+		t.Fatalf("unable to stop the legacy daemon: %v", err)
+	}
+	select {
+	case msg := <-stops:
+		if msg.ClientId == "" {
+			t.Error("expected the stop message to name the client's socket")
+		}
+	default:
+		t.Fatal("expected the legacy daemon to receive a stop message")
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cpendery/wock/client"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	apiCmd.Flags().BoolVar(&apiTokenOnly, "token", false, "only print the token, for use in scripts")
+	rootCmd.AddCommand(apiCmd)
+}
+
+var (
+	apiCmd = &cobra.Command{
+		Use:   "api",
+		Short: "prints the address and token of the daemon's admin api",
+		Long: `prints the address and token of the daemon's admin api
+
+the admin api is served when the daemon is started with --api, requests
+authenticate with an "Authorization: Bearer <token>" header`,
+		Args: cobra.ExactArgs(0),
+		RunE: runAPICmd,
+	}
+	apiTokenOnly bool
+)
+
+func runAPICmd(_ *cobra.Command, _ []string) error {
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil && errors.Is(err, client.ErrDaemonOffline) {
+		return client.ErrDaemonOffline
+	} else if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	status, err := c.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var addr string
+	for _, listener := range status.Listeners {
+		if listener.Protocol == "api" {
+			addr = listener.Addr
+			break
+		}
+	}
+	if addr == "" {
+		return errors.New("the admin api isn't enabled, run `wock restart --api` to enable it")
+	}
+	token, err := c.APIToken(ctx)
+	if err != nil {
+		return err
+	}
+	if apiTokenOnly {
+		fmt.Println(token)
+		return nil
+	}
+	logger.Printf("url    %s\n", color.BlueString("http://%s/v1", addr))
+	logger.Printf("token  %s\n", token)
+	return nil
+}
@@ -1,11 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
 	"github.com/cpendery/wock/cert"
-	"github.com/cpendery/wock/client"
 	"github.com/spf13/cobra"
 )
 
@@ -21,17 +21,18 @@ var clearCmd = &cobra.Command{
 }
 
 func runClearCommand(_ *cobra.Command, _ []string) error {
-	if !cert.IsInstalled() {
+	if !isRootless() && !cert.IsInstalled() {
 		return errors.New("local CA is not installed, run `wock install` to install the CA")
 	}
 
 	startDaemon()
-	c, err := client.NewClient()
+	ctx := context.Background()
+	c, err := newClient(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
 	defer c.Close()
-	if err := c.Clear(); err != nil {
+	if err := c.Clear(ctx); err != nil {
 		return err
 	}
 	logger.Println("Successfully cleared all hosts")
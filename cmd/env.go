@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/model"
+	"github.com/spf13/cobra"
+)
+
+const (
+	shellPosix      = "sh"
+	shellFish       = "fish"
+	shellPowershell = "powershell"
+)
+
+func init() {
+	envCmd.Flags().StringVar(&envShell, "shell", defaultShell(), "shell to print the variables for, one of sh, fish, or powershell")
+	rootCmd.AddCommand(envCmd)
+}
+
+var (
+	envCmd = &cobra.Command{
+		Use:   "env",
+		Short: "print proxy and CA bundle variables pointing tools at the daemon",
+		Long: `print proxy and CA bundle variables pointing tools at the daemon
+
+run eval "$(wock env)" to only wock hosts for the current shell, the
+proxy passes through every host that isn't wocked so the variables keep
+working as hosts are added or removed`,
+		Args: cobra.ExactArgs(0),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			switch envShell {
+			case shellPosix, shellFish, shellPowershell:
+				return nil
+			default:
+				return fmt.Errorf("unknown shell '%s'", envShell)
+			}
+		},
+		RunE: runEnvCmd,
+	}
+	envShell string
+)
+
+func defaultShell() string {
+	if runtime.GOOS == "windows" {
+		return shellPowershell
+	}
+	return shellPosix
+}
+
+// formatEnv sets the variable to the value in single quotes, escaping the quotes the way each
+// shell expects since paths like the CA bundle can contain them
+func formatEnv(name string, value string) string {
+	switch envShell {
+	case shellFish:
+		value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+		return fmt.Sprintf("set -gx %s '%s'", name, value)
+	case shellPowershell:
+		value = strings.ReplaceAll(value, `'`, `''`)
+		return fmt.Sprintf("$env:%s = '%s'", name, value)
+	default:
+		value = strings.ReplaceAll(value, `'`, `'\''`)
+		return fmt.Sprintf("export %s='%s'", name, value)
+	}
+}
+
+// proxyEnv builds the variables pointing tools at the daemon's proxy and trusting the local CA,
+// lowercase adds the lowercase proxy variables some tools, like curl, exclusively read
+func proxyEnv(status *model.DaemonStatus, lowercase bool) ([][2]string, error) {
+	addr, err := proxyAddr(status)
+	if err != nil {
+		return nil, err
+	}
+	caFile, err := cert.CAFile()
+	if err != nil {
+		return nil, err
+	}
+	bundleFile, foundSystem, err := cert.WriteBundle()
+	if err != nil {
+		return nil, err
+	}
+	if !foundSystem {
+		fmt.Fprintf(os.Stderr, "unable to find the system's trusted roots, %s only trusts the local CA\n", bundleFile)
+	}
+	proxyURL := "http://" + addr
+	noProxy := strings.Join([]string{"localhost", "127.0.0.1", "::1"}, ",")
+	vars := [][2]string{
+		{"HTTP_PROXY", proxyURL},
+		{"HTTPS_PROXY", proxyURL},
+		{"NO_PROXY", noProxy},
+		// curl, openssl, and python's ssl module
+		{"CURL_CA_BUNDLE", bundleFile},
+		{"SSL_CERT_FILE", bundleFile},
+		// python requests
+		{"REQUESTS_CA_BUNDLE", bundleFile},
+		// node appends extra CAs to its own roots
+		{"NODE_EXTRA_CA_CERTS", caFile},
+	}
+	if lowercase {
+		vars = append(vars, [2]string{"http_proxy", proxyURL}, [2]string{"https_proxy", proxyURL}, [2]string{"no_proxy", noProxy})
+	}
+	return vars, nil
+}
+
+func runEnvCmd(_ *cobra.Command, _ []string) error {
+	status, err := proxyStatus()
+	if err != nil {
+		return err
+	}
+	// windows doesn't distinguish the lowercase variables from the uppercase ones
+	vars, err := proxyEnv(status, envShell != shellPowershell)
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		fmt.Println(formatEnv(v[0], v[1]))
+	}
+	return nil
+}
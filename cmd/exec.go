@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	execCmd.Flags().StringArrayVar(&execHosts, "host", nil, "host to wock while the command runs as host=directory or host=upstream, can be repeated")
+	execCmd.MarkFlagRequired("host")
+	// flags after the command belong to it rather than wock
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(execCmd)
+}
+
+var (
+	execCmd = &cobra.Command{
+		Use:   "exec --host [host]=[directory|upstream] -- [command]",
+		Short: "wock hosts for a single command",
+		Long: `wock hosts for a single command
+
+the hosts are wocked while the command runs with proxy and CA bundle
+variables pointing it at the daemon, then removed once it exits. wock
+exits with the command's exit code.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runExecCmd,
+	}
+	execHosts []string
+)
+
+// exitCodeError exits wock with a specific code without printing anything
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func parseExecHosts(specs []string) ([]model.MockMessageData, error) {
+	var mocks []model.MockMessageData
+	for _, spec := range specs {
+		host, target, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid host '%s', expected host=directory or host=upstream", spec)
+		}
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !hosts.IsValidHostname(host) {
+			return nil, fmt.Errorf("provided host '%s' is an invalid hostname", host)
+		}
+		// the hosts are only for the command, so they're left out of the hosts file
+		mock := model.MockMessageData{Host: host, ProxyOnly: true}
+		if err := setMockTarget(&mock, target); err != nil {
+			return nil, err
+		}
+		mocks = append(mocks, mock)
+	}
+	return mocks, nil
+}
+
+func runExecCmd(cmd *cobra.Command, args []string) error {
+	if !isRootless() && !cert.IsInstalled() {
+		return errors.New("local CA is not installed, run `wock install` to install the CA")
+	}
+	mocks, err := parseExecHosts(execHosts)
+	if err != nil {
+		return err
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("failed to run %s: %w", args[0], err)
+	}
+
+	startDaemon()
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	status, err := c.StartProxy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start daemon proxy: %w", err)
+	}
+	for _, mock := range mocks {
+		for _, host := range status.Hosts {
+			if host.Host == mock.Host {
+				return fmt.Errorf("host %s is already wocked, remove it with `wock rm %s` first", mock.Host, mock.Host)
+			}
+		}
+	}
+	env, err := proxyEnv(status, runtime.GOOS != "windows")
+	if err != nil {
+		return err
+	}
+
+	var mocked []string
+	defer func() {
+		if len(mocked) == 0 {
+			return
+		}
+		if _, err := c.Remove(ctx, mocked...); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove wocked hosts: %s\n", err)
+		}
+	}()
+	for _, mock := range mocks {
+		if err := c.Mock(ctx, mock); err != nil {
+			return fmt.Errorf("failed to mock host %s: %w", mock.Host, err)
+		}
+		mocked = append(mocked, mock.Host)
+		fmt.Fprintf(os.Stderr, "mocking host '%s' with %s\n", color.MagentaString(mock.Host), color.BlueString(mock.Directory+mock.Upstream))
+	}
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	child.Env = os.Environ()
+	for _, v := range env {
+		child.Env = append(child.Env, v[0]+"="+v[1])
+	}
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", args[0], err)
+	}
+	// keep running until the command exits so the hosts are always removed, interrupts from the
+	// terminal already reach the command since it shares the process group
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			if sig != os.Interrupt {
+				child.Process.Signal(sig)
+			}
+		}
+	}()
+	if err := child.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("failed to run %s: %w", args[0], err)
+		}
+		cmd.SilenceErrors = true
+		code := exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// exit the way shells report a command killed by a signal
+			code = 128 + int(status.Signal())
+		} else if code < 0 {
+			code = 1
+		}
+		return &exitCodeError{code: code}
+	}
+	return nil
+}
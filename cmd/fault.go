@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/cpendery/wock/fault"
+	"github.com/cpendery/wock/model"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	faultCmd.Flags().Float64Var(&faults.ErrorRate, "error-rate", 0, "percentage of requests answered with the error status")
+	faultCmd.Flags().IntVar(&faults.ErrorStatus, "error-status", http.StatusServiceUnavailable, "5xx status returned for error faults")
+	faultCmd.Flags().Float64Var(&faults.ResetRate, "reset-rate", 0, "percentage of requests whose connection is reset mid-response")
+	faultCmd.Flags().Float64Var(&faults.TruncateRate, "truncate-rate", 0, "percentage of requests whose response body is cut short")
+	faultCmd.Flags().Float64Var(&faults.HangRate, "hang-rate", 0, "percentage of requests that hang until the client times out")
+	faultCmd.Flags().StringArrayVar(&faults.Paths, "path", nil, "only inject faults into paths matching the glob (e.g. '/api/*'), can be repeated")
+	rootCmd.AddCommand(faultCmd)
+}
+
+var (
+	faultCmd = &cobra.Command{
+		Use:   "fault [host]",
+		Short: "inject faults into the responses of a currently wocked host",
+		Long: `inject faults into the responses of a currently wocked host
+
+rates are percentages of requests, running without any rates removes all faults`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFaultCmd,
+	}
+	faults model.FaultProfile
+)
+
+func runFaultCmd(_ *cobra.Command, args []string) error {
+	if err := fault.Validate(faults); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil {
+		logger.Println("Daemon is offline, no hosts to inject faults into")
+		return nil
+	}
+	defer c.Close()
+	host := args[0]
+	if err := c.Fault(ctx, host, faults); err != nil {
+		slog.Debug("failed to set host faults", slog.String("error", err.Error()), slog.String("host", host))
+		return err
+	}
+	if faults.Enabled() {
+		fmt.Printf("injecting faults into host '%s': %s\n", color.MagentaString(host), fault.Describe(faults))
+	} else {
+		fmt.Printf("removed faults from host '%s'\n", color.MagentaString(host))
+	}
+	return nil
+}
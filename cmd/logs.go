@@ -2,25 +2,61 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/cpendery/wock/accesslog"
 	"github.com/cpendery/wock/daemon"
 	"github.com/spf13/cobra"
 )
 
+const (
+	logsDateFormat = "2006-01-02"
+	// access log lines can carry long paths, lines longer than this are skipped when listing
+	maxAccessLogLine = 1 << 20
+)
+
 func init() {
+	logsCmd.Flags().BoolVar(&logsAccess, "access", false, "print the access log of served requests instead of the daemon's logs")
+	logsCmd.Flags().StringSliceVar(&logsHosts, "host", nil, "only print requests to the host or glob, can be repeated (implies --access)")
+	logsCmd.Flags().StringSliceVar(&logsStatuses, "status", nil, "only print requests with the status (e.g. 404) or class (e.g. 5xx), can be repeated (implies --access)")
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "only print requests since a time (e.g. 2006-01-02T15:04:05Z) or duration ago (e.g. 15m) (implies --access)")
+	logsCmd.Flags().StringVar(&logsUntil, "until", "", "only print requests until a time or duration ago (implies --access)")
 	rootCmd.AddCommand(logsCmd)
 }
 
-var logsCmd = &cobra.Command{
-	Use:   "logs",
-	Short: "prints daemon's logs to stdout",
-	Args:  cobra.ExactArgs(0),
-	RunE:  runLogsCmd,
-}
+var (
+	logsCmd = &cobra.Command{
+		Use:   "logs",
+		Short: "prints daemon's logs to stdout",
+		Long: `prints daemon's logs to stdout
+
+the access log has a line for every request served for a wocked host, in the
+common log format or as json lines depending on the daemon's --access-log-format,
+and includes the rotated access logs`,
+		Args: cobra.ExactArgs(0),
+		RunE: runLogsCmd,
+	}
+	logsAccess   bool
+	logsHosts    []string
+	logsStatuses []string
+	logsSince    string
+	logsUntil    string
+)
 
 func runLogsCmd(_ *cobra.Command, _ []string) error {
+	filtered := len(logsHosts) != 0 || len(logsStatuses) != 0 || logsSince != "" || logsUntil != ""
+	if logsAccess || filtered {
+		filter, err := accessLogFilter()
+		if err != nil {
+			return err
+		}
+		return printAccessLog(filter)
+	}
 	f, err := os.Open(daemon.WockDaemonLogFile)
 	if err != nil {
 		return fmt.Errorf("unable to read daemon logs: %w", err)
@@ -32,3 +68,107 @@ func runLogsCmd(_ *cobra.Command, _ []string) error {
 	}
 	return nil
 }
+
+func accessLogFilter() (accesslog.Filter, error) {
+	filter := accesslog.Filter{Hosts: logsHosts}
+	for _, status := range logsStatuses {
+		statusRange, err := accesslog.ParseStatus(status)
+		if err != nil {
+			return filter, err
+		}
+		filter.Statuses = append(filter.Statuses, statusRange)
+	}
+	var err error
+	if filter.Since, err = parseLogsTime(logsSince); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseLogsTime(logsUntil); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseLogsTime parses a timestamp, a date, or a duration before now
+func parseLogsTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(logsDateFormat, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected a time like 2006-01-02T15:04:05Z, a date, or a duration like 15m", value)
+}
+
+func printAccessLog(filter accesslog.Filter) error {
+	files, err := accesslog.Files(daemon.WockAccessLogFile)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, file := range files {
+		if err := printAccessLogFile(file, filter, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printAccessLogFile(file string, filter accesslog.Filter, out *bufio.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("unable to read access log: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, tooLong, err := readAccessLogLine(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read access log: %w", err)
+		}
+		if tooLong {
+			slog.Debug("skipping access log line over the size limit", slog.String("file", file))
+			continue
+		}
+		entry, err := accesslog.Parse(string(line))
+		if err != nil {
+			slog.Debug("skipping invalid access log line", slog.String("file", file), slog.String("error", err.Error()))
+			continue
+		}
+		if filter.Match(entry) {
+			out.Write(line)
+			out.WriteByte('\n')
+		}
+	}
+}
+
+// readAccessLogLine reads the next line without its line ending, discarding lines longer than
+// maxAccessLogLine so a single one doesn't end the listing
+func readAccessLogLine(r *bufio.Reader) ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+			tooLong = len(line) > maxAccessLogLine
+		}
+		if !isPrefix {
+			if tooLong {
+				return nil, true, nil
+			}
+			return line, false, nil
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cpendery/wock/client"
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/pac"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	pacCmd.Flags().BoolVar(&pacURL, "url", false, "print the url the daemon serves the pac file on, which always reflects the current hosts")
+	rootCmd.AddCommand(pacCmd)
+}
+
+var (
+	pacCmd = &cobra.Command{
+		Use:   "pac",
+		Short: "print a proxy auto-config file routing the wocked hosts to the daemon",
+		Long: `print a proxy auto-config file routing the wocked hosts to the daemon
+
+the printed file is a snapshot of the wocked hosts, point browsers at
+the url from --url instead to pick up hosts as they're added or removed`,
+		Args: cobra.ExactArgs(0),
+		RunE: runPacCmd,
+	}
+	pacURL bool
+)
+
+// daemonStatus fetches the status of a running daemon
+func daemonStatus() (*model.DaemonStatus, error) {
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil && errors.Is(err, client.ErrDaemonOffline) {
+		return nil, client.ErrDaemonOffline
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	return c.Status(ctx)
+}
+
+// proxyStatus is the daemon's status after making sure its proxy is running
+func proxyStatus() (*model.DaemonStatus, error) {
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil && errors.Is(err, client.ErrDaemonOffline) {
+		return nil, client.ErrDaemonOffline
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	return c.StartProxy(ctx)
+}
+
+// proxyAddr picks the address clients should use to reach the daemon's proxy, preferring ipv4
+// loopback and swapping addresses listening on every interface for loopback
+func proxyAddr(status *model.DaemonStatus) (string, error) {
+	var addr string
+	for _, listener := range status.Listeners {
+		if listener.Protocol != "proxy" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(listener.Addr)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		if candidate := net.JoinHostPort(host, port); addr == "" || host == "127.0.0.1" {
+			addr = candidate
+		}
+	}
+	if addr == "" {
+		return "", errors.New("wock daemon isn't running its proxy, check the daemon logs")
+	}
+	return addr, nil
+}
+
+func runPacCmd(_ *cobra.Command, _ []string) error {
+	status, err := proxyStatus()
+	if err != nil {
+		return err
+	}
+	addr, err := proxyAddr(status)
+	if err != nil {
+		return err
+	}
+	if pacURL {
+		fmt.Printf("http://%s%s\n", addr, pac.Path)
+		return nil
+	}
+	var mockedHosts []string
+	for _, host := range status.Hosts {
+		mockedHosts = append(mockedHosts, host.Host)
+	}
+	fmt.Print(pac.Generate(addr, mockedHosts))
+	return nil
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/config"
+	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+}
+
+var recordCmd = &cobra.Command{
+	Use:   "record [domain] [directory]",
+	Short: "proxy a host to its real server and record the responses into a directory",
+	Args: func(_ *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(2)(nil, args); err != nil {
+			return err
+		}
+		host := strings.ToLower(args[0])
+		if !hosts.IsValidHostname(host) {
+			return fmt.Errorf("provided host '%s' is an invalid hostname", host)
+		}
+		if config.IsUpstream(args[1]) {
+			return errors.New("recordings can only be written to a directory")
+		}
+		return nil
+	},
+	RunE: runRecordCmd,
+}
+
+func runRecordCmd(_ *cobra.Command, args []string) error {
+	if !isRootless() && !cert.IsInstalled() {
+		return errors.New("local CA is not installed, run `wock install` to install the CA")
+	}
+	host := args[0]
+	if err := os.MkdirAll(args[1], 0755); err != nil {
+		return fmt.Errorf("unable to create recording directory: %w", err)
+	}
+	absDir, err := config.IsValidDirectory(args[1])
+	if err != nil {
+		return err
+	}
+
+	startDaemon()
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	if err := c.Mock(ctx, model.MockMessageData{Host: host, Directory: *absDir, Record: true}); err != nil {
+		return fmt.Errorf("failed to record host %s: %w", host, err)
+	}
+	fmt.Printf("recording host '%s' into %s, replay it later with `wock %s %s`\n", color.MagentaString(host), color.BlueString(*absDir), host, args[1])
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/har"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	replayCmd.Flags().BoolVar(&matchBody, "match-body", false, "require request bodies to match the recorded requests")
+	rootCmd.AddCommand(replayCmd)
+}
+
+var (
+	replayCmd = &cobra.Command{
+		Use:   "replay [har file]",
+		Short: "wock every host in a har file with its recorded responses",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runReplayCmd,
+	}
+	matchBody bool
+)
+
+func runReplayCmd(_ *cobra.Command, args []string) error {
+	if !isRootless() && !cert.IsInstalled() {
+		return errors.New("local CA is not installed, run `wock install` to install the CA")
+	}
+	harFile, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to resolve har file path: %w", err)
+	}
+	archive, err := har.Load(harFile, matchBody)
+	if err != nil {
+		return err
+	}
+	if len(archive.Hosts()) == 0 {
+		return fmt.Errorf("har file %s doesn't contain any hosts to wock", harFile)
+	}
+
+	startDaemon()
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	replayedHosts, err := c.Replay(ctx, harFile, matchBody)
+	if err != nil {
+		return fmt.Errorf("failed to replay %s: %w", harFile, err)
+	}
+	for _, host := range replayedHosts {
+		fmt.Printf("mocking host '%s' with responses from %s\n", color.MagentaString(host), color.BlueString(harFile))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cpendery/wock/client"
+	"github.com/cpendery/wock/pipe"
+	"github.com/spf13/cobra"
+)
+
+const (
+	restartTimeout = 15 * time.Second
+	// restartPollInterval is how often the running daemon is checked while waiting for it to stop
+	restartPollInterval = 100 * time.Millisecond
+)
+
+func init() {
+	addDaemonFlags(restartCmd.Flags())
+	rootCmd.AddCommand(restartCmd)
+}
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "replaces the running wock daemon, e.g. after upgrading wock",
+	Long: `replaces the running wock daemon, e.g. after upgrading wock
+
+the new daemon restores the hosts wocked by the previous one unless it
+was started with --ephemeral, and takes the same flags as wock start`,
+	Args: cobra.ExactArgs(0),
+	RunE: runRestartCommand,
+}
+
+func runRestartCommand(_ *cobra.Command, _ []string) error {
+	resolveDaemonOptions()
+	if err := daemonOptions.Validate(); err != nil {
+		return err
+	}
+	if err := client.StopDaemon(context.Background()); err != nil && !errors.Is(err, client.ErrDaemonOffline) {
+		return fmt.Errorf("unable to stop the running daemon: %w", err)
+	}
+	deadline := time.Now().Add(restartTimeout)
+	ticker := time.NewTicker(restartPollInterval)
+	defer ticker.Stop()
+	for pipe.IsServerPipeOpen() {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the running daemon to stop")
+		}
+		<-ticker.C
+	}
+	startDaemon()
+	if !pipe.IsServerPipeOpen() {
+		return errors.New("unable to start the daemon, check the daemon logs")
+	}
+	logger.Println("Successfully restarted daemon")
+	return nil
+}
@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"path/filepath"
+	"strings"
 
 	"github.com/cpendery/wock/client"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -12,23 +18,42 @@ func init() {
 }
 
 var rmCmd = &cobra.Command{
-	Use:   "rm [host]",
-	Short: "remove a currently wocked host",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runRmCmd,
+	Use:   "rm [host|har file|glob]...",
+	Short: "remove currently wocked hosts or har sessions",
+	Long: `remove currently wocked hosts or har sessions
+
+hosts can be matched with glob patterns, e.g. 'wock rm "*.example.com"'`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runRmCmd,
 }
 
 func runRmCmd(_ *cobra.Command, args []string) error {
-	c, err := client.NewClient()
-	if err != nil {
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil && errors.Is(err, client.ErrDaemonOffline) {
 		logger.Println("Daemon is offline, no hosts to remove")
 		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+	var patterns []string
+	for _, arg := range args {
+		if strings.HasSuffix(strings.ToLower(arg), ".har") {
+			if harFile, err := filepath.Abs(arg); err == nil {
+				arg = harFile
+			}
+		}
+		patterns = append(patterns, arg)
 	}
-	host := args[0]
 
-	if err := c.Remove(host); err != nil {
-		slog.Debug("failed to remove host", slog.String("error", err.Error()), slog.String("host", host))
+	removed, err := c.Remove(ctx, patterns...)
+	if err != nil {
+		slog.Debug("failed to remove hosts", slog.String("error", err.Error()), slog.String("hosts", strings.Join(patterns, " ")))
 		return err
 	}
+	for _, host := range removed {
+		fmt.Printf("removed host '%s'\n", color.MagentaString(host))
+	}
 	return nil
 }
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/cpendery/wock/admin"
@@ -13,20 +15,27 @@ import (
 	"github.com/cpendery/wock/config"
 	"github.com/cpendery/wock/daemon"
 	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
 	"github.com/cpendery/wock/pipe"
+	"github.com/cpendery/wock/version"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+const (
+	defaultSPAFallback = "index.html"
+)
+
 var (
 	rootCmd = &cobra.Command{
-		Use: `wock [domain] [directory] [flags]
+		Use: `wock [domain] [directory|upstream] [flags]
   wock [alias] [flags]`,
 		Short: "mock web hosts",
 		Long: `wock - mock the web 
 
 wock is a tool for mocking a host/domain and serving all traffic
-that host locally via http/https.
+that host locally via http/https, either from a directory or by
+proxying to an upstream such as a local dev server.
 
 complete documentation is available at https://github.com/cpendery/wock`,
 		Args: func(_ *cobra.Command, args []string) error {
@@ -41,11 +50,13 @@ complete documentation is available at https://github.com/cpendery/wock`,
 				return nil
 			case 2:
 				host := strings.ToLower(args[0])
-				dir := strings.ToLower(args[1])
 				if !hosts.IsValidHostname(host) {
 					return fmt.Errorf("provided host '%s' is an invalid hostname", host)
 				}
-				if _, err := config.IsValidDirectory(dir); err != nil {
+				if config.IsUpstream(args[1]) {
+					return nil
+				}
+				if _, err := config.IsValidDirectory(args[1]); err != nil {
 					return err
 				}
 			default:
@@ -53,56 +64,141 @@ complete documentation is available at https://github.com/cpendery/wock`,
 			}
 			return nil
 		},
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			if isRootless() {
+				pipe.UseRootless()
+			}
+		},
 		SilenceUsage: true,
+		Version:      version.Get(),
 		RunE:         rootExec,
 	}
 	verboseLogging bool
+	passthrough    bool
+	spaFallback    string
 	logger         = log.New(os.Stdout, "", 0)
 )
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verboseLogging, "verbose", "v", false, "enable verbose logging")
+	rootCmd.Flags().BoolVarP(&passthrough, "passthrough", "p", false, "proxy requests for files missing from the directory to the real host")
+	rootCmd.Flags().StringVar(&spaFallback, "spa", "", "serve a fallback file (default index.html) for html requests that don't match a file")
+	rootCmd.Flags().Lookup("spa").NoOptDefVal = defaultSPAFallback
+	addThrottleFlags(rootCmd.Flags())
 }
 
 func startDaemon() {
-	daemonRunning := pipe.IsServerPipeOpen()
-	if !daemonRunning && !admin.IsAdmin() {
+	if pipe.IsServerPipeOpen() {
+		return
+	}
+	resolveDaemonOptions()
+	if daemonOptions.APIToken == "" {
+		daemonOptions.APIToken = os.Getenv(wockAPITokenVariable)
+	}
+	switch {
+	case daemonOptions.Rootless && admin.IsDetached():
+		daemon.NewDaemon(daemonOptions).Start()
+	case daemonOptions.Rootless:
+		admin.RunDetached()
+		printProxySettings()
+	case !admin.IsAdmin():
 		admin.RunAsElevated()
+	default:
+		daemon.NewDaemon(daemonOptions).Start()
 	}
-	if !daemonRunning && admin.IsAdmin() {
-		daemon.NewDaemon().Start()
+}
+
+// setMockTarget points the mock at an upstream or directory, depending on the target. Directories
+// are made absolute since the daemon doesn't share our working directory, the daemon validates the rest.
+func setMockTarget(mock *model.MockMessageData, target string) error {
+	if config.IsUpstream(target) {
+		mock.Upstream = target
+		return nil
+	}
+	absDir, err := filepath.Abs(target)
+	if err != nil {
+		return fmt.Errorf("unable to check working directory: %w", err)
 	}
+	mock.Directory = absDir
+	return nil
 }
 
 func rootExec(cmd *cobra.Command, args []string) error {
-	if !cert.IsInstalled() {
+	// a rootless daemon can't install the CA into the system stores, tools are pointed at it instead
+	if !isRootless() && !cert.IsInstalled() {
 		return errors.New("local CA is not installed, run `wock install` to install the CA")
 	}
 
+	var mock model.MockMessageData
+	var target string
+	if len(args) == 1 {
+		alias := config.GetAlias(args[0])
+		mock.Host, target = alias.Host, alias.Directory
+		mock.Passthrough = alias.Passthrough
+		mock.SPAFallback = alias.SPA
+	} else {
+		mock.Host, target = args[0], args[1]
+	}
+	if cmd.Flags().Changed("passthrough") {
+		mock.Passthrough = passthrough
+	}
+	if cmd.Flags().Changed("spa") {
+		mock.SPAFallback = spaFallback
+	}
+
+	throttle, err := parseThrottleFlags()
+	if err != nil {
+		return err
+	}
+	mock.Throttle = throttle
+
+	if err := setMockTarget(&mock, target); err != nil {
+		return err
+	}
+
 	startDaemon()
-	c, err := client.NewClient()
+	ctx := context.Background()
+	c, err := newClient(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
 	defer c.Close()
-	var host, dir string
-	if len(args) == 1 {
-		host, dir = config.GetAlias(args[0])
-	} else {
-		host = args[0]
-		dir = args[1]
+	if err := c.Mock(ctx, mock); err != nil {
+		return fmt.Errorf("failed to mock host %s: %w", mock.Host, err)
 	}
-	absDir, _ := config.IsValidDirectory(dir)
-	err = c.Mock(host, *absDir)
-	if err != nil {
-		return fmt.Errorf("failed to mock host %s: %w", host, err)
+	switch {
+	case mock.Upstream != "":
+		fmt.Printf("mocking host '%s' with upstream %s\n", color.MagentaString(mock.Host), color.BlueString(mock.Upstream))
+	case mock.Passthrough:
+		fmt.Printf("mocking host '%s' with files from %s, passing through to the real host otherwise\n", color.MagentaString(mock.Host), color.BlueString(mock.Directory))
+	default:
+		fmt.Printf("mocking host '%s' with files from %s\n", color.MagentaString(mock.Host), color.BlueString(mock.Directory))
 	}
-	fmt.Printf("mocking host '%s' with files from %s\n", color.MagentaString(host), color.BlueString(*absDir))
 	return nil
 }
 
+// newClient connects to the daemon, pointing at `wock restart` when the daemon is running another
+// version of wock
+func newClient(ctx context.Context) (*client.Client, error) {
+	c, err := client.NewClient(ctx)
+	var mismatch *client.VersionMismatchError
+	if errors.As(err, &mismatch) {
+		return nil, fmt.Errorf("%w, run `wock restart` to replace it", err)
+	} else if err != nil {
+		return nil, err
+	}
+	if daemonVersion := c.DaemonVersion(); daemonVersion != version.Get() {
+		fmt.Fprintf(os.Stderr, "wock daemon is running version %s, run `wock restart` to upgrade it to %s\n", daemonVersion, version.Get())
+	}
+	return c, nil
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code) // skipcq: RVV-A0003
+		}
 		os.Exit(1) // skipcq: RVV-A0003
 	}
 }
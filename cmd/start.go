@@ -1,20 +1,104 @@
 package cmd
 
 import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cpendery/wock/accesslog"
+	"github.com/cpendery/wock/daemon"
+	"github.com/cpendery/wock/dns"
+	"github.com/cpendery/wock/pac"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func init() {
+	addDaemonFlags(startCmd.Flags())
 	rootCmd.AddCommand(startCmd)
 }
 
-var startCmd = &cobra.Command{
-	Use:   "start",
-	Short: "starts the wock daemon",
-	Args:  cobra.ExactArgs(0),
-	Run:   runStartCommand,
+func addDaemonFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&daemonOptions.DNS, "dns", false, "resolve wocked hosts, including wildcards, with a local dns server instead of the hosts file")
+	flags.StringVar(&daemonOptions.DNSAddr, "dns-addr", dns.DefaultAddr, "address the local dns server listens on")
+	flags.BoolVar(&daemonOptions.Ephemeral, "ephemeral", false, "don't persist wocked hosts or restore them from a previous daemon")
+	flags.StringSliceVar(&daemonOptions.HTTPAddrs, "http", nil, "address the http server listens on, can be repeated (default 127.0.0.1:80 and [::1]:80)")
+	flags.StringSliceVar(&daemonOptions.HTTPSAddrs, "https", nil, "address the https server listens on, can be repeated (default 127.0.0.1:443 and [::1]:443)")
+	flags.BoolVar(&daemonOptions.LAN, "lan", false, "allow listening on addresses reachable from the network, addresses without a host listen on every interface")
+	flags.BoolVar(&daemonOptions.Rootless, "rootless", false, "run the daemon as the current user, serving wocked hosts through a forward proxy (also set by WOCK_ROOTLESS=1)")
+	flags.StringSliceVar(&daemonOptions.ProxyAddrs, "proxy", nil, "loopback address the forward proxy listens on, can be repeated (default 127.0.0.1:8888 and [::1]:8888), the proxy otherwise only starts when rootless or needed by pac, env, or exec")
+	flags.BoolVar(&daemonOptions.API, "api", false, "serve the admin api, see `wock api` for its address and token")
+	flags.StringVar(&daemonOptions.APIAddr, "api-addr", daemon.DefaultAPIAddr, "loopback address the admin api listens on")
+	flags.StringVar(&daemonOptions.APIToken, "api-token", "", "token admin api requests authenticate with (default generated, also set by WOCK_API_TOKEN)")
+	flags.StringVar((*string)(&daemonOptions.AccessLogFormat), "access-log-format", string(accesslog.FormatCLF), "format requests are written to the access log in, one of clf or json")
+	flags.Int64Var(&accessLogMaxSizeMB, "access-log-max-size", defaultAccessLogMaxSizeMB, "size in megabytes the access log is rotated at, 0 to never rotate by size")
+	flags.DurationVar(&daemonOptions.AccessLogMaxAge, "access-log-max-age", defaultAccessLogMaxAge, "age the access log is rotated at, 0 to never rotate by age")
+	flags.IntVar(&daemonOptions.AccessLogMaxBackups, "access-log-backups", defaultAccessLogBackups, "how many rotated access logs are kept, 0 to keep all of them")
+}
+
+const (
+	wockRootlessVariable = "WOCK_ROOTLESS"
+	wockAPITokenVariable = "WOCK_API_TOKEN"
+
+	defaultAccessLogMaxSizeMB = 10
+	defaultAccessLogMaxAge    = 7 * 24 * time.Hour
+	defaultAccessLogBackups   = 5
+)
+
+var (
+	startCmd = &cobra.Command{
+		Use:   "start",
+		Short: "starts the wock daemon",
+		Args:  cobra.ExactArgs(0),
+		RunE:  runStartCommand,
+	}
+	daemonOptions = daemon.Options{
+		AccessLogMaxAge:     defaultAccessLogMaxAge,
+		AccessLogMaxBackups: defaultAccessLogBackups,
+	}
+	accessLogMaxSizeMB int64 = defaultAccessLogMaxSizeMB
+)
+
+// isRootless reports whether the daemon should run rootless, either from the flag or, so it
+// applies to commands that implicitly start the daemon, the environment
+func isRootless() bool {
+	b, err := strconv.ParseBool(os.Getenv(wockRootlessVariable))
+	return daemonOptions.Rootless || (b && err == nil)
+}
+
+// resolveDaemonOptions fills in the daemon options that don't come straight from flags, which
+// also applies when the daemon is started implicitly without them
+func resolveDaemonOptions() {
+	daemonOptions.Rootless = isRootless()
+	daemonOptions.AccessLogMaxSize = accessLogMaxSizeMB << 20
+}
+
+// printProxySettings shows how to point browsers and tools at a rootless daemon's proxy
+func printProxySettings() {
+	status, err := daemonStatus()
+	if err != nil {
+		slog.Debug("failed to check daemon status", slog.String("error", err.Error()))
+		return
+	}
+	addr, err := proxyAddr(status)
+	if err != nil {
+		slog.Debug("failed to find daemon proxy", slog.String("error", err.Error()))
+		return
+	}
+	proxyURL := "http://" + addr
+	logger.Printf("wock is running rootless, point browsers and tools at its proxy:\n\n")
+	logger.Printf("  proxy     %s\n", color.BlueString(proxyURL))
+	logger.Printf("  pac file  %s\n\n", color.BlueString(proxyURL+pac.Path))
+	logger.Printf("run %s to point the current shell at it\n", color.BlueString(`eval "$(wock env)"`))
 }
 
-func runStartCommand(_ *cobra.Command, _ []string) {
+func runStartCommand(_ *cobra.Command, _ []string) error {
+	resolveDaemonOptions()
+	if err := daemonOptions.Validate(); err != nil {
+		return err
+	}
 	startDaemon()
+	return nil
 }
@@ -1,43 +1,87 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/cpendery/wock/client"
+	"github.com/cpendery/wock/fault"
 	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/throttle"
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
 )
 
 func init() {
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", outputTable, "output format, one of table, json, or yaml")
 	rootCmd.AddCommand(statusCmd)
 }
 
-var statusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "check the current status of the wock daemon",
-	Args:  cobra.ExactArgs(0),
-	Run:   runStatusCmd,
-}
+var (
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "check the current status of the wock daemon",
+		Long: `check the current status of the wock daemon
+
+the command exits with a non-zero status if the daemon is offline, in
+every output format`,
+		Args: cobra.ExactArgs(0),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			switch statusOutput {
+			case outputTable, outputJSON, outputYAML:
+				return nil
+			default:
+				return fmt.Errorf("unknown output format '%s'", statusOutput)
+			}
+		},
+		RunE: runStatusCmd,
+	}
+	statusOutput string
+)
 
-func printDaemonStatus(hosts *[]model.MockedHost) {
-	if hosts == nil {
+func printDaemonStatus(status *model.DaemonStatus) {
+	if status == nil {
 		fmt.Print("\n")
 		fmt.Printf("wock daemon [%s]\n", color.RedString("offline"))
 	} else {
 		fmt.Print("\n")
 		fmt.Printf("wock daemon [%s]\n", color.GreenString("online"))
+		var listeners []string
+		for _, listener := range status.Listeners {
+			listeners = append(listeners, fmt.Sprintf("%s://%s", listener.Protocol, listener.Addr))
+		}
+		if len(listeners) != 0 {
+			fmt.Printf("listening on %s\n", strings.Join(listeners, ", "))
+		}
 		fmt.Print("\n")
 		data := [][]string{}
-		for _, host := range *hosts {
-			data = append(data, []string{host.Host, host.Directory})
+		for _, host := range status.Hosts {
+			data = append(data, []string{
+				host.Host,
+				host.Type,
+				host.Target(),
+				throttle.Describe(host.Throttle),
+				fault.Describe(host.Faults),
+				strconv.FormatUint(host.Requests, 10),
+			})
 		}
 
 		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader([]string{"Mocked Host", "Directory Served"})
+		table.SetHeader([]string{"Mocked Host", "Type", "Served From", "Throttle", "Faults", "Requests"})
 		for _, v := range data {
 			table.Append(v)
 		}
@@ -46,18 +90,65 @@ func printDaemonStatus(hosts *[]model.MockedHost) {
 	}
 }
 
-func runStatusCmd(_ *cobra.Command, _ []string) {
-	c, err := client.NewClient()
+func printStructuredStatus(status *model.DaemonStatus) error {
+	if status == nil {
+		status = &model.DaemonStatus{Online: false, Hosts: []model.HostStatus{}}
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
 	if err != nil {
+		return fmt.Errorf("unable to marshal status: %w", err)
+	}
+	if statusOutput == outputYAML {
+		if data, err = jsonToYAML(data); err != nil {
+			return fmt.Errorf("unable to marshal status: %w", err)
+		}
+	}
+	fmt.Println(string(data))
+	if !status.Online {
+		return client.ErrDaemonOffline
+	}
+	return nil
+}
+
+// jsonToYAML converts json to yaml, keeping the json field names and ordering
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	var clearStyle func(*yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			clearStyle(child)
+		}
+	}
+	clearStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+func runStatusCmd(cmd *cobra.Command, _ []string) error {
+	var status *model.DaemonStatus
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil && !errors.Is(err, client.ErrDaemonOffline) {
+		return err
+	} else if err != nil {
 		slog.Debug("failed to create client", slog.String("error", err.Error()))
-		printDaemonStatus(nil)
-		return
+	} else {
+		defer c.Close()
+		if status, err = c.Status(ctx); err != nil {
+			slog.Debug("failed to check daemon status", slog.String("error", err.Error()))
+		}
 	}
-	mockedHosts, err := c.CheckStatus()
-	if err != nil {
-		slog.Debug("failed to check daemon status", slog.String("error", err.Error()))
-		printDaemonStatus(nil)
-		return
+	// the status is already printed, so only the exit code should reflect the error
+	cmd.SilenceErrors = true
+	if statusOutput == outputTable {
+		printDaemonStatus(status)
+		if status == nil {
+			return client.ErrDaemonOffline
+		}
+		return nil
 	}
-	printDaemonStatus(mockedHosts)
+	return printStructuredStatus(status)
 }
@@ -1,8 +1,8 @@
 package cmd
 
 import (
+	"context"
 	"errors"
-	"fmt"
 
 	"github.com/cpendery/wock/client"
 	"github.com/spf13/cobra"
@@ -20,15 +20,12 @@ var stopCmd = &cobra.Command{
 }
 
 func runStopCommand(_ *cobra.Command, _ []string) error {
-	c, err := client.NewClient()
-	if err != nil && errors.Is(err, client.ErrUnableToDialDaemon) {
+	// daemons left running by other versions of wock, including ones from before the handshake, are stopped too
+	err := client.StopDaemon(context.Background())
+	if err != nil && errors.Is(err, client.ErrDaemonOffline) {
 		logger.Println("Daemon is already offline")
 		return nil
 	} else if err != nil {
-		return fmt.Errorf("failed to create client: %w", err)
-	}
-	defer c.Close()
-	if err := c.Stop(); err != nil {
 		return err
 	}
 	logger.Println("Successfully stopped daemon")
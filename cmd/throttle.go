@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/throttle"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func init() {
+	addThrottleFlags(throttleCmd.Flags())
+	rootCmd.AddCommand(throttleCmd)
+}
+
+var (
+	throttleCmd = &cobra.Command{
+		Use:   "throttle [host]",
+		Short: "change the latency and bandwidth of a currently wocked host",
+		Long: `change the latency and bandwidth of a currently wocked host
+
+omitted options are disabled, so running without options removes all throttling`,
+		Args: cobra.ExactArgs(1),
+		RunE: runThrottleCmd,
+	}
+	latencyFlag   string
+	ttfbFlag      string
+	bandwidthFlag string
+)
+
+func addThrottleFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&latencyFlag, "latency", "", "delay each request by a fixed or random duration (e.g. 200ms or 200ms..1500ms)")
+	flags.StringVar(&ttfbFlag, "ttfb", "", "delay the first byte of each response (e.g. 500ms)")
+	flags.StringVar(&bandwidthFlag, "bandwidth", "", "limit the throughput of each response (e.g. 256kbps)")
+}
+
+func parseThrottleFlags() (model.Throttle, error) {
+	var t model.Throttle
+	if latencyFlag != "" {
+		minLatency, maxLatency, err := throttle.ParseLatency(latencyFlag)
+		if err != nil {
+			return t, err
+		}
+		t.LatencyMin, t.LatencyMax = minLatency, maxLatency
+	}
+	if ttfbFlag != "" {
+		ttfb, err := throttle.ParseTTFB(ttfbFlag)
+		if err != nil {
+			return t, err
+		}
+		t.TTFB = ttfb
+	}
+	if bandwidthFlag != "" {
+		bandwidth, err := throttle.ParseBandwidth(bandwidthFlag)
+		if err != nil {
+			return t, err
+		}
+		t.Bandwidth = bandwidth
+	}
+	return t, nil
+}
+
+func runThrottleCmd(_ *cobra.Command, args []string) error {
+	t, err := parseThrottleFlags()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	c, err := newClient(ctx)
+	if err != nil {
+		logger.Println("Daemon is offline, no hosts to throttle")
+		return nil
+	}
+	defer c.Close()
+	host := args[0]
+	if err := c.Throttle(ctx, host, t); err != nil {
+		slog.Debug("failed to throttle host", slog.String("error", err.Error()), slog.String("host", host))
+		return err
+	}
+	if t.Enabled() {
+		fmt.Printf("throttling host '%s' with %s\n", color.MagentaString(host), throttle.Describe(t))
+	} else {
+		fmt.Printf("removed throttling from host '%s'\n", color.MagentaString(host))
+	}
+	return nil
+}
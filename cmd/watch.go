@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cpendery/wock/client"
+	"github.com/cpendery/wock/model"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+const (
+	watchRetryInterval = 1 * time.Second
+	watchTimeFormat    = "15:04:05.000"
+)
+
+func init() {
+	watchCmd.Flags().StringVarP(&watchOutput, "output", "o", outputTable, "output format, one of table or json")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var (
+	watchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "streams the daemon's events as they happen",
+		Long: `streams the daemon's events as they happen
+
+events include hosts being wocked, updated, or removed, certificates being
+issued, listeners starting, and every request served for a wocked host with
+what answered it. the json output prints an event per line.
+
+watching continues across daemon restarts until interrupted`,
+		Args: cobra.ExactArgs(0),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			switch watchOutput {
+			case outputTable, outputJSON:
+				return nil
+			default:
+				return fmt.Errorf("unknown output format '%s'", watchOutput)
+			}
+		},
+		RunE: runWatchCmd,
+	}
+	watchOutput string
+)
+
+func runWatchCmd(_ *cobra.Command, _ []string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	waiting := false
+	for ctx.Err() == nil {
+		c, err := newClient(ctx)
+		if errors.Is(err, client.ErrDaemonOffline) {
+			if !waiting && watchOutput == outputTable {
+				logger.Println("waiting for the wock daemon to start")
+			}
+			waiting = true
+			select {
+			case <-ctx.Done():
+			case <-time.After(watchRetryInterval):
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		waiting = false
+		events, err := c.Subscribe(ctx)
+		if err != nil {
+			c.Close()
+			if errors.Is(err, client.ErrUnsupportedRequest) {
+				return errors.New("the daemon doesn't support watching, run `wock restart` to replace it")
+			}
+			return err
+		}
+		for event := range events {
+			if err := printEvent(event); err != nil {
+				c.Close()
+				return err
+			}
+		}
+		c.Close()
+	}
+	return nil
+}
+
+func printEvent(event model.Event) error {
+	if watchOutput == outputJSON {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("unable to marshal event: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	timestamp := color.HiBlackString(event.Time.Local().Format(watchTimeFormat))
+	switch event.Type {
+	case model.EventRequest:
+		request := event.Request
+		logger.Printf("%s  %s %s %s %s  %s %s\n", timestamp, colorStatus(request.Status), request.Method, color.BlueString(event.Host), request.Path,
+			formatLatency(request.Latency), color.HiBlackString(request.Source))
+	case model.EventHostMocked:
+		logger.Printf("%s  %s %s from %s\n", timestamp, color.GreenString("wocked"), color.BlueString(event.Host), event.Target)
+	case model.EventHostUpdated:
+		logger.Printf("%s  %s %s\n", timestamp, color.YellowString("updated"), color.BlueString(event.Host))
+	case model.EventHostRemoved:
+		logger.Printf("%s  %s %s\n", timestamp, color.RedString("removed"), color.BlueString(event.Host))
+	case model.EventCertIssued:
+		logger.Printf("%s  %s for %s, expires %s\n", timestamp, color.CyanString("issued certificate"), color.BlueString(event.Host), event.CertExpiry.Local().Format(time.DateOnly))
+	case model.EventListening:
+		logger.Printf("%s  %s %s://%s\n", timestamp, color.CyanString("listening on"), event.Listener.Protocol, event.Listener.Addr)
+	case model.EventStopped:
+		logger.Printf("%s  %s\n", timestamp, color.RedString("daemon stopped"))
+	default:
+		logger.Printf("%s  %s %s\n", timestamp, event.Type, event.Host)
+	}
+	return nil
+}
+
+func formatLatency(latency time.Duration) time.Duration {
+	if latency < time.Millisecond {
+		return latency.Round(time.Microsecond)
+	}
+	return latency.Round(time.Millisecond)
+}
+
+func colorStatus(status int) string {
+	switch {
+	case status >= 500:
+		return color.RedString("%d", status)
+	case status >= 400:
+		return color.YellowString("%d", status)
+	case status == 0:
+		// the connection was dropped before a response, e.g. by a fault
+		return color.RedString("---")
+	default:
+		return color.GreenString("%d", status)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,13 +18,15 @@ import (
 const wockConfigName = ".wock.json"
 
 type config struct {
-	Aliases []alias `json:"aliases,omitempty"`
+	Aliases []Alias `json:"aliases,omitempty"`
 }
 
-type alias struct {
-	Alias     string `json:"alias"`
-	Host      string `json:"host"`
-	Directory string `json:"directory"`
+type Alias struct {
+	Alias       string `json:"alias"`
+	Host        string `json:"host"`
+	Directory   string `json:"directory"`
+	Passthrough bool   `json:"passthrough,omitempty"`
+	SPA         string `json:"spa,omitempty"`
 }
 
 var WockConfig config
@@ -66,6 +69,11 @@ func IsValidAlias(alias string) bool {
 	return false
 }
 
+func IsUpstream(userInput string) bool {
+	u, err := url.Parse(userInput)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func IsValidDirectory(userInput string) (*string, error) {
 	var dir string
 	if filepath.IsAbs(userInput) {
@@ -90,23 +98,59 @@ func IsValidDirectory(userInput string) (*string, error) {
 	}
 }
 
-func GetAlias(alias string) (string, string) {
+// FallbackPath returns where the fallback is in the directory, refusing fallbacks outside of it
+func FallbackPath(dir string, fallback string) (string, error) {
+	fallbackPath := filepath.Join(dir, filepath.FromSlash(fallback))
+	rel, err := filepath.Rel(dir, fallbackPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unable to use fallback %s as it's outside of %s", fallback, dir)
+	}
+	return fallbackPath, nil
+}
+
+func IsValidFallback(dir string, fallback string) error {
+	fallbackPath, err := FallbackPath(dir, fallback)
+	if err != nil {
+		return err
+	}
+	fileinfo, err := os.Stat(fallbackPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("unable to use fallback %s as it doesn't exist", fallbackPath)
+	} else if err != nil {
+		return fmt.Errorf("unable to validate fallback exists: %w", err)
+	} else if fileinfo.IsDir() {
+		return fmt.Errorf("unable to use fallback %s as it is a directory", fallbackPath)
+	}
+	return nil
+}
+
+func GetAlias(alias string) Alias {
 	for _, aliasItem := range WockConfig.Aliases {
 		if strings.EqualFold(aliasItem.Alias, alias) {
-			return aliasItem.Host, aliasItem.Directory
+			return aliasItem
 		}
 	}
 	log.Fatalln("invalid alias ", alias)
-	return "", ""
+	return Alias{}
 }
 
 func validateConfig() error {
 	for _, aliasItem := range WockConfig.Aliases {
-		if _, err := IsValidDirectory(aliasItem.Directory); err != nil {
-			return err
-		} else if !hosts.IsValidHostname(aliasItem.Host) {
+		if !hosts.IsValidHostname(aliasItem.Host) {
 			return fmt.Errorf("invalid hostname '%s'", aliasItem.Host)
 		}
+		if IsUpstream(aliasItem.Directory) {
+			continue
+		}
+		dir, err := IsValidDirectory(aliasItem.Directory)
+		if err != nil {
+			return err
+		}
+		if aliasItem.SPA != "" {
+			if err := IsValidFallback(*dir, aliasItem.SPA); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
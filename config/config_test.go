@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFallbackPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "site")
+	tests := []struct {
+		fallback string
+		want     string
+		wantErr  bool
+	}{
+		{fallback: "index.html", want: filepath.Join(dir, "index.html")},
+		{fallback: "/index.html", want: filepath.Join(dir, "index.html")},
+		{fallback: "app/index.html", want: filepath.Join(dir, "app", "index.html")},
+		{fallback: "app/../index.html", want: filepath.Join(dir, "index.html")},
+		{fallback: "..index.html", want: filepath.Join(dir, "..index.html")},
+		{fallback: "../index.html", wantErr: true},
+		{fallback: "..", wantErr: true},
+		{fallback: "app/../../index.html", wantErr: true},
+		{fallback: "../site-other/index.html", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := FallbackPath(dir, tt.fallback)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FallbackPath(%q) returned error %v", tt.fallback, err)
+		} else if got != tt.want {
+			t.Errorf("FallbackPath(%q) = %s, want %s", tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidFallback(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "site")
+	for _, file := range []string{filepath.Join(dir, "index.html"), filepath.Join(root, "secret.html")} {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("unable to create %s: %v", filepath.Dir(file), err)
+		}
+		if err := os.WriteFile(file, []byte("<html></html>"), 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", file, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatalf("unable to create assets: %v", err)
+	}
+	tests := []struct {
+		fallback string
+		wantErr  bool
+	}{
+		{fallback: "index.html"},
+		{fallback: "missing.html", wantErr: true},
+		{fallback: "assets", wantErr: true},
+		{fallback: "../secret.html", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := IsValidFallback(dir, tt.fallback); (err != nil) != tt.wantErr {
+			t.Errorf("IsValidFallback(%q) returned error %v", tt.fallback, err)
+		}
+	}
+}
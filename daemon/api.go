@@ -0,0 +1,248 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/pipe"
+)
+
+const (
+	// DefaultAPIAddr is where the admin api listens when no address is given
+	DefaultAPIAddr  = "127.0.0.1:7788"
+	apiPrefix       = "/v1"
+	maxAPIBodyBytes = 10 << 20
+
+	apiErrorUnauthorized     model.ErrorCode = "unauthorized"
+	apiErrorNotFound         model.ErrorCode = "notFound"
+	apiErrorMethodNotAllowed model.ErrorCode = "methodNotAllowed"
+)
+
+// generateAPIToken creates the token clients of the admin api authenticate with when none is given
+func generateAPIToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("unable to generate api token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// validateAPIAddr keeps the admin api on loopback, since it can serve any directory on the machine
+func validateAPIAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid api address '%s': %w", addr, err)
+	}
+	if host == "" || !isLoopback(host) {
+		return fmt.Errorf("the admin api only listens on loopback addresses, not '%s'", addr)
+	}
+	return nil
+}
+
+// apiToken is the token the admin api authenticates with, for clients on the socket
+func (d *Daemon) apiToken() (model.APITokenMessageData, error) {
+	if !d.options.API {
+		return model.APITokenMessageData{}, &requestError{code: model.ErrorCodeInvalidMessage, err: errors.New("the admin api isn't enabled")}
+	}
+	return model.APITokenMessageData{Token: d.options.APIToken}, nil
+}
+
+func (d *Daemon) authorizedAPIRequest(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(d.options.APIToken)) == 1
+}
+
+// handleAPI serves the admin api, a rest view over the same requests the socket accepts
+//
+//	GET    /v1/status                  daemon status
+//	GET    /v1/hosts                   wocked hosts
+//	POST   /v1/hosts                   wock a host, taking a mock message
+//	DELETE /v1/hosts                   stop wocking every host
+//	GET    /v1/hosts/{host}            a wocked host
+//	DELETE /v1/hosts/{host}            stop wocking a host, glob, or har file
+//	GET    /v1/hosts/{host}/throttle   a wocked host's throttle
+//	POST   /v1/hosts/{host}/throttle   set a wocked host's throttle
+//	DELETE /v1/hosts/{host}/throttle   remove a wocked host's throttle
+//	GET    /v1/hosts/{host}/faults     a wocked host's faults, likewise with POST and DELETE
+//	POST   /v1/replay                  replay a har file, taking a replay message
+//	GET    /v1/logs                    the daemon's logs
+//	POST   /v1/stop                    stop the daemon
+func (d *Daemon) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if !d.authorizedAPIRequest(r) {
+		writeAPIError(w, http.StatusUnauthorized, apiErrorUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+	path, ok := strings.CutPrefix(r.URL.Path, apiPrefix+"/")
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "unknown api path "+r.URL.Path)
+		return
+	}
+	resource, rest, _ := strings.Cut(path, "/")
+	switch {
+	case resource == "status" && rest == "" && r.Method == http.MethodGet:
+		d.serveAPIRequest(w, model.StatusMessage, nil)
+	case resource == "hosts" && rest == "":
+		d.handleAPIHosts(w, r)
+	case resource == "hosts":
+		host, setting, _ := strings.Cut(rest, "/")
+		d.handleAPIHost(w, r, host, setting)
+	case resource == "replay" && rest == "" && r.Method == http.MethodPost:
+		body, ok := readAPIBody(w, r)
+		if ok {
+			d.serveAPIRequest(w, model.ReplayMessage, body)
+		}
+	case resource == "logs" && rest == "" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeFile(w, r, WockDaemonLogFile)
+	case resource == "stop" && rest == "" && r.Method == http.MethodPost:
+		// the daemon exits even if it failed to clean up, the same as when stopped over the socket
+		d.serveAPIRequest(w, model.StopMessage, nil)
+		http.NewResponseController(w).Flush()
+		pipe.Teardown()
+		os.Exit(0)
+	default:
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, fmt.Sprintf("unknown api endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (d *Daemon) handleAPIHosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAPIResponse(w, d.apiStatus().Hosts)
+	case http.MethodPost:
+		if body, ok := readAPIBody(w, r); ok {
+			d.serveAPIRequest(w, model.MockMessage, body)
+		}
+	case http.MethodDelete:
+		d.serveAPIRequest(w, model.ClearMessage, nil)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, apiErrorMethodNotAllowed, r.Method+" isn't supported on "+r.URL.Path)
+	}
+}
+
+func (d *Daemon) handleAPIHost(w http.ResponseWriter, r *http.Request, host string, setting string) {
+	host = strings.ToLower(host)
+	switch {
+	case setting == "" && r.Method == http.MethodGet:
+		if hostStatus, ok := d.apiHostStatus(w, host); ok {
+			writeAPIResponse(w, hostStatus)
+		}
+	case setting == "" && r.Method == http.MethodDelete:
+		data, _ := json.Marshal(model.UnmockMessageData{Hosts: []string{host}})
+		d.serveAPIRequest(w, model.UnmockMessage, data)
+	case setting == "throttle" && r.Method == http.MethodGet:
+		if hostStatus, ok := d.apiHostStatus(w, host); ok {
+			writeAPIResponse(w, hostStatus.Throttle)
+		}
+	case setting == "throttle" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		var throttle model.Throttle
+		if r.Method == http.MethodPost && !decodeAPIBody(w, r, &throttle) {
+			return
+		}
+		data, _ := json.Marshal(model.ThrottleMessageData{Host: host, Throttle: throttle})
+		d.serveAPIRequest(w, model.ThrottleMessage, data)
+	case setting == "faults" && r.Method == http.MethodGet:
+		if hostStatus, ok := d.apiHostStatus(w, host); ok {
+			writeAPIResponse(w, hostStatus.Faults)
+		}
+	case setting == "faults" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		var faults model.FaultProfile
+		if r.Method == http.MethodPost && !decodeAPIBody(w, r, &faults) {
+			return
+		}
+		data, _ := json.Marshal(model.FaultMessageData{Host: host, Faults: faults})
+		d.serveAPIRequest(w, model.FaultMessage, data)
+	default:
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, fmt.Sprintf("unknown api endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (d *Daemon) apiStatus() model.DaemonStatus {
+	resp, _ := d.handle(model.StatusMessage, nil, nil)
+	return resp.(model.DaemonStatus)
+}
+
+func (d *Daemon) apiHostStatus(w http.ResponseWriter, host string) (model.HostStatus, bool) {
+	for _, hostStatus := range d.apiStatus().Hosts {
+		if hostStatus.Host == host {
+			return hostStatus, true
+		}
+	}
+	err := fmt.Errorf("host %s %w", host, errHostNotMocked)
+	writeAPIError(w, apiStatusCode(errorCode(err)), errorCode(err), err.Error())
+	return model.HostStatus{}, false
+}
+
+// serveAPIRequest handles the request the same way as if it came from the socket, reporting
+// whether it succeeded
+func (d *Daemon) serveAPIRequest(w http.ResponseWriter, msgType model.MessageType, data []byte) bool {
+	resp, err := d.handle(msgType, data, nil)
+	if err != nil {
+		code := errorCode(err)
+		writeAPIError(w, apiStatusCode(code), code, err.Error())
+		return false
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	writeAPIResponse(w, resp)
+	return true
+}
+
+func apiStatusCode(code model.ErrorCode) int {
+	switch code {
+	case model.ErrorCodeInvalidMessage:
+		return http.StatusBadRequest
+	case model.ErrorCodeHostNotMocked, model.ErrorCodeUnknownMessageType:
+		return http.StatusNotFound
+	case model.ErrorCodePermissionDenied:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func readAPIBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, model.ErrorCodeInvalidMessage, fmt.Sprintf("unable to read request body: %s", err))
+		return nil, false
+	}
+	return body, true
+}
+
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, model.ErrorCodeInvalidMessage, fmt.Sprintf("invalid request body: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeAPIResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write api response", slog.String("error", err.Error()))
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code model.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(model.ErrorMessageData{Code: code, Message: message}); err != nil {
+		slog.Error("failed to write api error", slog.String("error", err.Error()))
+	}
+}
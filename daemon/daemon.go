@@ -1,9 +1,10 @@
 package daemon
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,26 +12,126 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/cpendery/wock/accesslog"
 	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/dns"
+	"github.com/cpendery/wock/har"
 	"github.com/cpendery/wock/hosts"
 	"github.com/cpendery/wock/model"
 	"github.com/cpendery/wock/pipe"
+	"github.com/cpendery/wock/resolver"
+	"github.com/cpendery/wock/serve"
+	"github.com/cpendery/wock/version"
 )
 
 type Daemon struct {
+	options     Options
 	mockedHosts map[string]model.MockedHost
+	harSessions map[string]*har.Archive
 	lock        sync.RWMutex
 	serverHttp  http.Server
 	serverHttps http.Server
+	serverProxy http.Server
+	serverAPI   http.Server
+	// interceptHttp and interceptHttps feed CONNECT tunnels to wocked hosts into the servers
+	interceptHttp  *connListener
+	interceptHttps *connListener
+	listeners      []model.Listener
+	proxyStarted   bool
+	dnsServer      *dns.Server
+	startedAt      time.Time
+	handler        serve.Handler
+	events         eventHub
+	accessLog      *accesslog.Writer
 }
 
+type Options struct {
+	// DNS resolves wocked hosts, including wildcards, with a dns server instead of the hosts file
+	DNS     bool
+	DNSAddr string
+	// Ephemeral skips persisting wocked hosts and restoring them when the daemon starts
+	Ephemeral bool
+	// HTTPAddrs and HTTPSAddrs are the addresses the servers listen on, addresses without a host
+	// listen on loopback, or on every interface when LAN is set
+	HTTPAddrs  []string
+	HTTPSAddrs []string
+	// LAN allows listening on addresses reachable from other machines on the network
+	LAN bool
+	// Rootless runs the daemon as the current user, serving wocked hosts only through the forward
+	// proxy instead of editing the hosts file and binding privileged ports
+	Rootless bool
+	// ProxyAddrs are the addresses the forward proxy listens on
+	ProxyAddrs []string
+	// API serves the admin api on the loopback APIAddr, authenticated with APIToken or a generated
+	// token when it's empty
+	API      bool
+	APIAddr  string
+	APIToken string
+	// AccessLogFormat is the format requests are logged in, with the access log rotated once it's
+	// larger than AccessLogMaxSize or older than AccessLogMaxAge
+	AccessLogFormat     accesslog.Format
+	AccessLogMaxSize    int64
+	AccessLogMaxAge     time.Duration
+	AccessLogMaxBackups int
+}
+
+// Validate checks the options so mistakes are reported before the daemon is started
+func (o Options) Validate() error {
+	if o.Rootless && o.DNS {
+		return errors.New("the dns server configures the system resolver, which needs root, so it can't be used rootless")
+	}
+	if o.DNS && runtime.GOOS == "windows" {
+		return errors.New("the dns server can't be used on windows since the system resolver can't be pointed at it")
+	}
+	if _, err := listenAddrs(o.HTTPAddrs, defaultHTTPPort, o.LAN); err != nil {
+		return err
+	}
+	if _, err := listenAddrs(o.HTTPSAddrs, defaultHTTPSPort, o.LAN); err != nil {
+		return err
+	}
+	for _, addr := range o.ProxyAddrs {
+		if host, _, err := net.SplitHostPort(addr); err == nil && host != "" && !isLoopback(host) {
+			return fmt.Errorf("proxy address %s isn't a loopback address, the proxy can't be reachable from the network", addr)
+		}
+	}
+	if _, err := listenAddrs(o.ProxyAddrs, defaultProxyPort, false); err != nil {
+		return err
+	}
+	if o.AccessLogFormat != "" {
+		if _, err := accesslog.ParseFormat(string(o.AccessLogFormat)); err != nil {
+			return err
+		}
+	}
+	if o.AccessLogMaxSize < 0 || o.AccessLogMaxAge < 0 || o.AccessLogMaxBackups < 0 {
+		return errors.New("access log rotation limits can't be negative")
+	}
+	if o.API && o.APIAddr != "" {
+		return validateAPIAddr(o.APIAddr)
+	}
+	return nil
+}
+
+const (
+	shutdownTimeout  = 5 * time.Second
+	defaultHTTPPort  = "80"
+	defaultHTTPSPort = "443"
+)
+
 var (
 	WockDaemonLogFile = filepath.Join(xdg.CacheHome, "wock", "daemon-logs.txt")
+	WockAccessLogFile = filepath.Join(xdg.CacheHome, "wock", "access.log")
+	errHostNotMocked  = errors.New("is not being wocked")
 )
 
 func setupDaemonLogging() {
@@ -45,133 +146,66 @@ func setupDaemonLogging() {
 	slog.SetDefault(logger)
 }
 
-func (d *Daemon) sendMessage(msg model.Message, clientId string, conn net.Conn) error {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("unable to marshal message: %w", err)
+// clientConn is a connection from a client, which responses to concurrent requests share
+type clientConn struct {
+	conn net.Conn
+	lock sync.Mutex
+	// peer is the user who connected, nil if the platform can't tell
+	peer *model.User
+	// done is closed once the client disconnects
+	done chan struct{}
+}
+
+// sendMessage responds to the request with the given id
+func (d *Daemon) sendMessage(msg model.Message, id string, conn *clientConn) error {
+	msg.Id = id
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return model.WriteMessage(conn.conn, msg)
+}
+
+// sendError responds to the request with the given id with a structured error
+func (d *Daemon) sendError(code model.ErrorCode, err error, id string, conn *clientConn) error {
+	data, marshalErr := json.Marshal(model.ErrorMessageData{Code: code, Message: err.Error()})
+	if marshalErr != nil {
+		return fmt.Errorf("unable to marshal error: %w", marshalErr)
 	}
-	conn.Write(data)
-	conn.Write([]byte("\n"))
-	return nil
+	return d.sendMessage(model.Message{MsgType: model.ErrorMessage, Data: data}, id, conn)
 }
 
-func (d *Daemon) handleMessage(msg model.Message) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-	conn, err := pipe.DialClient(msg.ClientId)
-	if err != nil {
-		slog.Error("failed to dial client", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
+func (d *Daemon) handleMessage(msg model.Message, conn *clientConn) {
+	var resp any
+	var err error
+	switch msg.MsgType {
+	case model.SubscribeMessage:
+		slog.Debug("received subscribe message")
+		d.subscribe(msg.Id, conn)
 		return
+	case model.APITokenMessage:
+		// answered here rather than in handle so the admin api can never serve its own token
+		slog.Debug("received api token message")
+		resp, err = d.apiToken()
+	default:
+		resp, err = d.handle(msg.MsgType, msg.Data, conn.peer)
 	}
-	defer conn.Close()
-	switch msg.MsgType {
-	case model.StatusMessage:
-		var mockedHosts []model.MockedHost
-		for _, mockedHost := range d.mockedHosts {
-			mockedHosts = append(mockedHosts, mockedHost)
-		}
-		data, err := json.Marshal(mockedHosts)
-		if err != nil {
-			slog.Error("failed to marshal status response", slog.String("error", err.Error()))
-			return
-		}
-		if err := d.sendMessage(
-			model.Message{MsgType: model.SuccessMessage, Data: data},
-			msg.ClientId,
-			conn,
-		); err != nil {
-			slog.Error("failed to response to a status message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
-			return
-		}
-	case model.MockMessage:
-		slog.Debug("received mock message")
-		var mockMessageData model.MockMessageData
-		if err := json.Unmarshal(msg.Data, &mockMessageData); err != nil {
-			slog.Error("invalid mock message", slog.String("error", err.Error()), slog.String("data", string(msg.Data)))
-			return
-		}
-		host := strings.ToLower(strings.TrimSpace(mockMessageData.Host))
-
-		if err := hosts.UpdateHosts(host, true); err != nil {
-			slog.Error("failed to update hosts file", slog.String("error", err.Error()))
-			return
-		}
-		slog.Debug("updated mocked hosts")
-		d.mockedHosts[host] = model.MockedHost{Host: host, Directory: mockMessageData.Directory}
-
-		slog.Debug("starting server http/s shutdowns")
-		if err := d.serverHttp.Shutdown(context.Background()); err != nil {
-			slog.Error("failed to shutdown http server", slog.String("error", err.Error()))
-			return
-		}
-		if err := d.serverHttps.Shutdown(context.Background()); err != nil {
-			slog.Error("failed to shutdown https server", slog.String("error", err.Error()))
-			return
-		}
-		slog.Debug("begin creation of http/s servers")
-		if err := d.generateNewCerts(); err != nil {
-			slog.Error("failed to generate new certs", slog.String("error", err.Error()))
-			os.Exit(1)
-		}
-		go d.httpServer()
-		go d.httpsServer()
-
-		if err := d.sendMessage(
-			model.Message{MsgType: model.SuccessMessage},
-			msg.ClientId,
-			conn,
-		); err != nil {
-			slog.Error("failed to response to a mock message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
-			return
-		}
-	case model.ClearMessage:
-		slog.Debug("received clear message")
-		hosts.ClearHosts()
-		for k := range d.mockedHosts {
-			delete(d.mockedHosts, k)
-		}
-		if err := d.sendMessage(
-			model.Message{MsgType: model.SuccessMessage},
-			msg.ClientId,
-			conn,
-		); err != nil {
-			slog.Error("failed to response to a clear message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
-			return
+	if err != nil {
+		err = d.sendError(errorCode(err), err, msg.Id, conn)
+	} else {
+		var data []byte
+		if resp != nil {
+			data, err = json.Marshal(resp)
 		}
-	case model.StopMessage:
-		slog.Debug("received stop message")
-		if err := d.sendMessage(
-			model.Message{MsgType: model.SuccessMessage},
-			msg.ClientId,
-			conn,
-		); err != nil {
-			slog.Error("failed to response to a stop message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
+		if err == nil {
+			err = d.sendMessage(model.Message{MsgType: model.SuccessMessage, Data: data}, msg.Id, conn)
 		}
+	}
+	if err != nil {
+		slog.Error("failed to response to a message", slog.String("id", msg.Id), slog.Int("msgType", int(msg.MsgType)), slog.String("error", err.Error()))
+	}
+	if msg.MsgType == model.StopMessage {
 		pipe.Teardown()
 		os.Exit(0)
-	case model.UnmockMessage:
-		slog.Debug("received unmock message")
-		host := string(msg.Data)
-		if _, ok := d.mockedHosts[host]; !ok {
-			if err := d.sendMessage(
-				model.Message{MsgType: model.ErrorMessage, Data: []byte(fmt.Sprintf("host %s is not being wocked", host))},
-				msg.ClientId,
-				conn,
-			); err != nil {
-				slog.Error("failed to response to a unmock message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
-			}
-		} else {
-			delete(d.mockedHosts, host)
-			if err := d.sendMessage(
-				model.Message{MsgType: model.SuccessMessage},
-				msg.ClientId,
-				conn,
-			); err != nil {
-				slog.Error("failed to response to a unmock message", slog.String("clientId", msg.ClientId), slog.String("error", err.Error()))
-			}
-		}
 	}
-
 }
 
 func create(p string) error {
@@ -186,113 +220,478 @@ func create(p string) error {
 	return nil
 }
 
-func (d *Daemon) generateNewCerts() error {
-	var hosts []string
+// resolveHost points the host at the daemon through the hosts file, hosts resolved by the
+// dns server are instead picked up by syncResolver
+func (d *Daemon) resolveHost(host string) error {
+	if !d.usesHostsFile() {
+		return nil
+	}
+	return hosts.UpdateHosts(host, true)
+}
+
+// usesHostsFile reports whether wocked hosts are resolved through the hosts file, rather than
+// the dns server or, when rootless, the forward proxy
+func (d *Daemon) usesHostsFile() bool {
+	return !d.options.DNS && !d.options.Rootless
+}
+
+// clearHosts removes every entry wock added to the hosts file, which a rootless daemon can't
+// have added in the first place
+func (d *Daemon) clearHosts() error {
+	if d.options.Rootless {
+		return nil
+	}
+	return hosts.ClearHosts()
+}
+
+func (d *Daemon) syncResolver() error {
+	if !d.options.DNS {
+		return nil
+	}
+	var mockedHosts []string
+	for host, mockedHost := range d.mockedHosts {
+		if !mockedHost.ProxyOnly {
+			mockedHosts = append(mockedHosts, host)
+		}
+	}
+	return dns.ConfigureSystem(d.options.DNSAddr, dns.Domains(mockedHosts))
+}
+
+func (d *Daemon) isMocked(host string) bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	_, ok := d.findMockedHost(host)
+	return ok
+}
+
+// isResolved reports whether the dns server should answer for the host, which proxy only hosts
+// are left out of
+func (d *Daemon) isResolved(host string) bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	mockedHost, ok := d.findMockedHost(host)
+	return ok && !mockedHost.ProxyOnly
+}
+
+func (d *Daemon) findMockedHost(host string) (model.MockedHost, bool) {
+	return serve.Find(d.mockedHosts, host)
+}
+
+// lookupHost finds the wocked host serving a request for the handler
+func (d *Daemon) lookupHost(host string) (model.MockedHost, *har.Archive, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	mockedHost, ok := d.findMockedHost(host)
+	return mockedHost, d.harSessions[mockedHost.Session], ok
+}
+
+func (d *Daemon) status() model.DaemonStatus {
+	status := model.DaemonStatus{
+		Online:    true,
+		Pid:       os.Getpid(),
+		Version:   version.Get(),
+		StartedAt: &d.startedAt,
+		Uptime:    time.Since(d.startedAt).Round(time.Second).String(),
+		Listeners: append([]model.Listener{}, d.listeners...),
+		Hosts:     []model.HostStatus{},
+	}
+	if d.options.DNS {
+		status.Listeners = append(status.Listeners, model.Listener{Protocol: "dns", Addr: d.options.DNSAddr})
+	}
 	for _, mockedHost := range d.mockedHosts {
-		hosts = append(hosts, mockedHost.Host)
+		var certExpiry *time.Time
+		if expiry, ok := d.handler.Issuer.Expiry(mockedHost.Host); ok {
+			certExpiry = &expiry
+		}
+		status.Hosts = append(status.Hosts, model.HostStatus{
+			MockedHost: mockedHost,
+			Type:       mockedHost.TargetType(),
+			CertExpiry: certExpiry,
+			Requests:   d.handler.Requests(mockedHost.Host),
+		})
 	}
-	if err := create(cert.WockCertFile); err != nil {
-		return fmt.Errorf("failed to create cert file: %w", err)
+	sort.Slice(status.Hosts, func(i, j int) bool { return status.Hosts[i].Host < status.Hosts[j].Host })
+	return status
+}
+
+// matchHosts expands a host, har session, or glob pattern into the mocked hosts it covers,
+// where removing any host of a har session removes the whole session
+func (d *Daemon) matchHosts(pattern string) []string {
+	pattern = strings.TrimSpace(pattern)
+	matched := map[string]struct{}{}
+	sessions := map[string]struct{}{}
+	if _, ok := d.harSessions[pattern]; ok {
+		sessions[pattern] = struct{}{}
 	}
-	if err := create(cert.WockKeyFile); err != nil {
-		return fmt.Errorf("failed to create key file: %w", err)
+	hostPattern := strings.ToLower(pattern)
+	for host, mockedHost := range d.mockedHosts {
+		if ok, _ := path.Match(hostPattern, host); ok || host == hostPattern {
+			matched[host] = struct{}{}
+			if mockedHost.Session != "" {
+				sessions[mockedHost.Session] = struct{}{}
+			}
+		}
 	}
-	return cert.CreateCert(hosts)
+	for host, mockedHost := range d.mockedHosts {
+		if _, ok := sessions[mockedHost.Session]; ok && mockedHost.Session != "" {
+			matched[host] = struct{}{}
+		}
+	}
+	var hosts []string
+	for host := range matched {
+		hosts = append(hosts, host)
+	}
+	return hosts
 }
 
-func (d *Daemon) httpsServer() {
-	mux := http.NewServeMux()
-	d.serverHttps = http.Server{
-		Handler: mux,
-		Addr:    ":443",
-	}
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		host := strings.Split(r.Host, ":")[0]
-		for _, mockedHost := range d.mockedHosts {
-			slog.Debug(host, "mocked", mockedHost.Host, "dir", mockedHost.Directory)
-			if mockedHost.Host == host {
-				server := http.FileServer(http.Dir(mockedHost.Directory))
-				server.ServeHTTP(w, r)
+// removeHosts unwocks every host matching the patterns and drops their certificates. Nothing is
+// removed if any of the patterns doesn't match a host.
+func (d *Daemon) removeHosts(patterns []string) ([]string, error) {
+	removing := map[string]struct{}{}
+	for _, pattern := range patterns {
+		matched := d.matchHosts(pattern)
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("host %s %w", pattern, errHostNotMocked)
+		}
+		for _, host := range matched {
+			removing[host] = struct{}{}
+		}
+	}
+	var removed []string
+	for host := range removing {
+		if d.usesHostsFile() && !d.mockedHosts[host].ProxyOnly {
+			if err := hosts.UpdateHosts(host, false); err != nil {
+				return removed, fmt.Errorf("unable to remove %s from the hosts file: %w", host, err)
 			}
 		}
-	})
-	slog.Debug("starting new https server")
-	if err := d.serverHttps.ListenAndServeTLS(cert.WockCertFile, cert.WockKeyFile); err != nil {
-		if err != http.ErrServerClosed {
-			slog.Error("https server failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("https server shutdown", slog.String("error", err.Error()))
+		session := d.mockedHosts[host].Session
+		delete(d.mockedHosts, host)
+		d.handler.Issuer.Forget(host)
+		d.handler.Unregister(host)
+		if session != "" && !d.hasSessionHosts(session) {
+			delete(d.harSessions, session)
 		}
+		d.events.publish(model.Event{Type: model.EventHostRemoved, Host: host})
+		removed = append(removed, host)
 	}
+	sort.Strings(removed)
+	if err := d.syncResolver(); err != nil {
+		return removed, fmt.Errorf("unable to update system resolver: %w", err)
+	}
+	return removed, nil
 }
 
-func (d *Daemon) httpServer() {
-	mux := http.NewServeMux()
-	d.serverHttp = http.Server{
-		Handler: mux,
-		Addr:    ":80",
-	}
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		host := strings.Split(r.Host, ":")[0]
-		for _, mockedHost := range d.mockedHosts {
-			slog.Debug(host, "mocked", mockedHost.Host, "dir", mockedHost.Directory)
-			if mockedHost.Host == host {
-				server := http.FileServer(http.Dir(mockedHost.Directory))
-				server.ServeHTTP(w, r)
+// stopServers drains in-flight requests, cutting off any that never finish on their own
+// (e.g. hang faults) after the shutdown timeout
+func (d *Daemon) stopServers() {
+	slog.Debug("starting server http/s shutdowns")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := d.serverHttp.Shutdown(ctx); err != nil {
+		slog.Debug("closing http server after shutdown timeout", slog.String("error", err.Error()))
+		d.serverHttp.Close()
+	}
+	if err := d.serverHttps.Shutdown(ctx); err != nil {
+		slog.Debug("closing https server after shutdown timeout", slog.String("error", err.Error()))
+		d.serverHttps.Close()
+	}
+	if err := d.serverProxy.Shutdown(ctx); err != nil {
+		slog.Debug("closing proxy server after shutdown timeout", slog.String("error", err.Error()))
+		d.serverProxy.Close()
+	}
+}
+
+// shutdown drains the servers and undoes every change the daemon made to the system, the
+// mocked hosts are kept in the persisted state so they can be restored on the next start
+func (d *Daemon) shutdown() error {
+	d.stopServers()
+	d.events.publish(model.Event{Type: model.EventStopped})
+	d.events.close()
+	if d.accessLog != nil {
+		d.accessLog.Close()
+	}
+	if d.dnsServer != nil {
+		d.dnsServer.Close()
+	}
+	var errs []error
+	if err := d.clearHosts(); err != nil {
+		errs = append(errs, fmt.Errorf("unable to remove hosts file entries: %w", err))
+	}
+	if d.options.DNS {
+		if err := dns.RestoreSystem(); err != nil {
+			errs = append(errs, fmt.Errorf("unable to restore system resolver: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Daemon) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	slog.Debug("received signal", slog.String("signal", sig.String()))
+	d.lock.Lock()
+	if err := d.shutdown(); err != nil {
+		slog.Error("failed to clean up during shutdown", slog.String("error", err.Error()))
+	}
+	pipe.Teardown()
+	os.Exit(0)
+}
+
+// listenAddrs expands the configured addresses, where a missing host means loopback unless lan
+// is set, and rejects addresses reachable from the network unless lan is set
+func listenAddrs(addrs []string, defaultPort string, lan bool) ([]string, error) {
+	if len(addrs) == 0 {
+		addrs = []string{":" + defaultPort}
+	}
+	var expanded []string
+	for _, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %s: %w", addr, err)
+		}
+		if port == "" {
+			port = defaultPort
+		}
+		switch {
+		case host == "" && lan:
+			expanded = append(expanded, net.JoinHostPort("", port))
+		case host == "":
+			expanded = append(expanded, net.JoinHostPort("127.0.0.1", port), net.JoinHostPort("::1", port))
+		case lan || isLoopback(host):
+			expanded = append(expanded, net.JoinHostPort(host, port))
+		default:
+			return nil, fmt.Errorf("listen address %s is reachable from the network, use --lan to listen on it anyway", addr)
+		}
+	}
+	return expanded, nil
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listen binds every address and serves on it in the background, addresses that can't be bound
+// (e.g. ::1 when ipv6 is disabled) are skipped as long as at least one of them is bound
+func (d *Daemon) listen(protocol string, addrs []string, serve func(net.Listener) error) error {
+	bound := false
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			slog.Error("failed to listen", slog.String("protocol", protocol), slog.String("addr", addr), slog.String("error", err.Error()))
+			continue
+		}
+		bound = true
+		listener := model.Listener{Protocol: protocol, Addr: l.Addr().String()}
+		d.listeners = append(d.listeners, listener)
+		d.events.publish(model.Event{Type: model.EventListening, Listener: &listener})
+		slog.Debug("listening", slog.String("protocol", protocol), slog.String("addr", l.Addr().String()))
+		go func() {
+			if err := serve(l); err != nil {
+				if err != http.ErrServerClosed {
+					slog.Error("server failed", slog.String("protocol", protocol), slog.String("error", err.Error()))
+				} else {
+					slog.Debug("server shutdown", slog.String("protocol", protocol), slog.String("addr", l.Addr().String()))
+				}
 			}
+		}()
+	}
+	if !bound {
+		return fmt.Errorf("unable to listen on any %s address", protocol)
+	}
+	return nil
+}
+
+// startServers binds the http, https, forward proxy, and admin api servers. A rootless daemon relies on the
+// proxy, so its http/https servers only get listeners when addresses are given since the default
+// ports need root. Any other daemon only starts the proxy when its addresses are given or a client
+// asks for it, and runs without it if its port is taken.
+func (d *Daemon) startServers() error {
+	if d.options.Rootless || len(d.options.ProxyAddrs) != 0 {
+		if err := d.startProxy(); err != nil {
+			if d.options.Rootless {
+				return err
+			}
+			slog.Error("failed to start proxy", slog.String("error", err.Error()))
 		}
-	})
-	slog.Debug("starting new http/s server")
-	if err := d.serverHttp.ListenAndServe(); err != nil {
-		if err != http.ErrServerClosed {
-			slog.Error("http server failed", slog.String("error", err.Error()))
-		} else {
-			slog.Debug("http server shutdown", slog.String("error", err.Error()))
+	}
+	d.interceptHttp = newConnListener(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	d.interceptHttps = newConnListener(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	go d.serverHttp.Serve(d.interceptHttp)
+	go d.serverHttps.ServeTLS(d.interceptHttps, "", "")
+	if !d.options.Rootless || len(d.options.HTTPAddrs) != 0 {
+		httpAddrs, err := listenAddrs(d.options.HTTPAddrs, defaultHTTPPort, d.options.LAN)
+		if err != nil {
+			return err
+		}
+		if err := d.listen("http", httpAddrs, d.serverHttp.Serve); err != nil {
+			return err
+		}
+	}
+	if !d.options.Rootless || len(d.options.HTTPSAddrs) != 0 {
+		httpsAddrs, err := listenAddrs(d.options.HTTPSAddrs, defaultHTTPSPort, d.options.LAN)
+		if err != nil {
+			return err
+		}
+		if err := d.listen("https", httpsAddrs, func(l net.Listener) error {
+			return d.serverHttps.ServeTLS(l, "", "")
+		}); err != nil {
+			return err
+		}
+	}
+	if d.options.API {
+		if err := d.listen("api", []string{d.options.APIAddr}, d.serverAPI.Serve); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
+// startProxy binds the forward proxy unless it's already listening, the proxy only ever listens on
+// loopback since it would otherwise be an open proxy
+func (d *Daemon) startProxy() error {
+	if d.proxyStarted {
+		return nil
+	}
+	proxyAddrs, err := listenAddrs(d.options.ProxyAddrs, defaultProxyPort, false)
+	if err != nil {
+		return err
+	}
+	if err := d.listen("proxy", proxyAddrs, d.serverProxy.Serve); err != nil {
+		return err
+	}
+	d.proxyStarted = true
+	return nil
+}
+
+// handleClient serves requests from a client until it disconnects, each request is handled
+// concurrently and answered on the same connection tagged with its id
 func (d *Daemon) handleClient(c net.Conn) {
 	defer c.Close()
-	reader := bufio.NewReader(c)
-
+	conn := &clientConn{conn: c, done: make(chan struct{})}
+	if uid, gid, err := pipe.PeerCredentials(c); err == nil {
+		conn.peer = &model.User{Uid: uid, Gid: gid}
+	} else {
+		slog.Debug("failed to check the client's credentials", slog.String("error", err.Error()))
+	}
+	var requests sync.WaitGroup
+	defer requests.Wait()
+	defer close(conn.done)
 	for {
-		data, err := reader.ReadBytes('\n')
-		if err != nil {
-			if err != io.EOF {
+		msg, err := model.ReadMessage(c)
+		if errors.Is(err, model.ErrUnsupportedVersion) && msg.MsgType != model.HelloMessage && msg.MsgType != model.StopMessage {
+			slog.Debug("received message from another protocol version", slog.String("error", err.Error()))
+			if err := d.sendError(model.ErrorCodeUnsupportedProtocol, err, msg.Id, conn); err != nil {
+				slog.Error("failed to response to a message", slog.String("id", msg.Id), slog.String("error", err.Error()))
+			}
+			continue
+		} else if err != nil && !errors.Is(err, model.ErrUnsupportedVersion) {
+			if !errors.Is(err, io.EOF) {
 				slog.Error("failed to read message", slog.String("error", err.Error()))
 			}
-			break
-		}
-		var msg model.Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			slog.Error("failed to unmarshal message", slog.String("error", err.Error()))
+			return
 		}
-		d.handleMessage(msg)
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			d.handleMessage(msg, conn)
+		}()
 	}
 }
 
-func NewDaemon() *Daemon {
-	return &Daemon{
+func NewDaemon(options Options) *Daemon {
+	if options.DNSAddr == "" {
+		options.DNSAddr = dns.DefaultAddr
+	}
+	if options.APIAddr == "" {
+		options.APIAddr = DefaultAPIAddr
+	}
+	if options.AccessLogFormat == "" {
+		options.AccessLogFormat = accesslog.FormatCLF
+	}
+	d := &Daemon{
+		options:     options,
 		mockedHosts: make(map[string]model.MockedHost),
+		harSessions: make(map[string]*har.Archive),
 		lock:        sync.RWMutex{},
-		serverHttp: http.Server{
-			Addr: ":80",
-		},
-		serverHttps: http.Server{
-			Addr: ":443",
+	}
+	d.handler.Lookup = d.lookupHost
+	d.handler.Served = d.requestServed
+	d.serverHttp = http.Server{
+		Handler: &d.handler,
+	}
+	d.serverHttps = http.Server{
+		Handler: &d.handler,
+		TLSConfig: &tls.Config{
+			GetCertificate: d.handler.GetCertificate,
 		},
 	}
+	d.serverProxy = http.Server{
+		Handler: http.HandlerFunc(d.handleProxy),
+	}
+	d.serverAPI = http.Server{
+		Handler: http.HandlerFunc(d.handleAPI),
+	}
+	return d
 }
 
 func (d *Daemon) Start() {
 	setupDaemonLogging()
 	slog.Debug("starting daemon")
+	d.startedAt = time.Now()
+	issuer, err := cert.NewIssuer()
+	if err != nil {
+		slog.Error("failed to load local CA", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	format, _ := accesslog.ParseFormat(string(d.options.AccessLogFormat))
+	d.accessLog, err = accesslog.Open(WockAccessLogFile, format, accesslog.Rotation{
+		MaxSize:    d.options.AccessLogMaxSize,
+		MaxAge:     d.options.AccessLogMaxAge,
+		MaxBackups: d.options.AccessLogMaxBackups,
+	})
+	if err != nil {
+		slog.Error("failed to open access log, requests won't be logged", slog.String("error", err.Error()))
+	}
+	issuer.Issued = d.certIssued
+	d.handler.Issuer = issuer
+	if d.options.API && d.options.APIToken == "" {
+		if d.options.APIToken, err = generateAPIToken(); err != nil {
+			slog.Error("failed to generate api token", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	if d.options.DNS {
+		// upstream nameservers are read before the system resolver is pointed at the daemon
+		d.dnsServer = &dns.Server{
+			Addr:     d.options.DNSAddr,
+			Upstream: resolver.Nameservers(),
+			IsMocked: d.isResolved,
+		}
+	}
+	d.restoreState()
+	if err := d.startServers(); err != nil {
+		slog.Error("failed to start servers", slog.String("error", err.Error()))
+		d.shutdown()
+		os.Exit(1)
+	}
 	l, err := pipe.ServerListen()
 	if err != nil {
 		slog.Error("failed to listen to daemon pipe", slog.String("error", err.Error()))
 	}
 	defer l.Close()
+	go d.handleSignals()
+	if d.dnsServer != nil {
+		go func() {
+			if err := d.dnsServer.ListenAndServe(); err != nil {
+				slog.Error("dns server failed", slog.String("error", err.Error()))
+			}
+		}()
+	}
 	for {
 		conn, err := l.Accept()
 		if err != nil {
@@ -0,0 +1,156 @@
+package daemon
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/cpendery/wock/accesslog"
+	"github.com/cpendery/wock/model"
+)
+
+const (
+	// subscriberBuffer is how many events a slow subscriber can fall behind before events are dropped
+	subscriberBuffer = 256
+	// drainTimeout bounds how long shutdown waits for subscribers to receive the last events
+	drainTimeout = 1 * time.Second
+)
+
+// eventHub fans events out to every subscribed client, dropping events for subscribers that fall
+// behind rather than slowing down the daemon
+type eventHub struct {
+	lock        sync.Mutex
+	subscribers map[chan model.Event]struct{}
+	closed      bool
+	active      sync.WaitGroup
+}
+
+// subscribe returns a channel of events, which is closed when the hub is, or nil when the hub is
+// already closed. Subscribers must unsubscribe once they stop reading.
+func (h *eventHub) subscribe() chan model.Event {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return nil
+	}
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan model.Event]struct{})
+	}
+	events := make(chan model.Event, subscriberBuffer)
+	h.subscribers[events] = struct{}{}
+	h.active.Add(1)
+	return events
+}
+
+func (h *eventHub) unsubscribe(events chan model.Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.subscribers, events)
+	h.active.Done()
+}
+
+func (h *eventHub) publish(event model.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.closed {
+		return
+	}
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			slog.Debug("dropping event for slow subscriber", slog.String("type", string(event.Type)))
+		}
+	}
+}
+
+// close ends every subscription, waiting a little for subscribers to receive the events they've
+// been sent
+func (h *eventHub) close() {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return
+	}
+	h.closed = true
+	for events := range h.subscribers {
+		close(events)
+	}
+	h.lock.Unlock()
+	drained := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		slog.Debug("subscribers didn't drain before shutdown")
+	}
+}
+
+func (d *Daemon) certIssued(host string, leaf *x509.Certificate) {
+	expiry := leaf.NotAfter
+	d.events.publish(model.Event{Type: model.EventCertIssued, Host: host, CertExpiry: &expiry})
+}
+
+func (d *Daemon) requestServed(host string, request model.RequestEvent) {
+	now := time.Now()
+	if d.accessLog != nil {
+		if err := d.accessLog.Write(accesslog.NewEntry(host, request, now)); err != nil {
+			slog.Error("failed to write access log", slog.String("error", err.Error()))
+		}
+	}
+	d.events.publish(model.Event{Time: now, Type: model.EventRequest, Host: host, Request: &request})
+}
+
+// subscribe streams events to the client as event messages tagged with the subscribe request's id,
+// starting with the daemon's listeners, until the client disconnects or the daemon stops
+func (d *Daemon) subscribe(id string, conn *clientConn) {
+	events := d.events.subscribe()
+	if events == nil {
+		return
+	}
+	defer d.events.unsubscribe(events)
+	if err := d.sendMessage(model.Message{MsgType: model.SuccessMessage}, id, conn); err != nil {
+		slog.Error("failed to response to a message", slog.String("id", id), slog.String("error", err.Error()))
+		return
+	}
+	for _, listener := range d.listeners {
+		listener := listener
+		if err := d.sendEvent(model.Event{Time: d.startedAt, Type: model.EventListening, Listener: &listener}, id, conn); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-conn.done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := d.sendEvent(event, id, conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (d *Daemon) sendEvent(event model.Event, id string, conn *clientConn) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to marshal event", slog.String("error", err.Error()))
+		return err
+	}
+	if err := d.sendMessage(model.Message{MsgType: model.EventMessage, Data: data}, id, conn); err != nil {
+		slog.Debug("failed to send event, dropping subscriber", slog.String("id", id), slog.String("error", err.Error()))
+		return err
+	}
+	return nil
+}
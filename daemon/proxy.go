@@ -0,0 +1,193 @@
+package daemon
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpendery/wock/pac"
+)
+
+const (
+	defaultProxyPort   = "8888"
+	tunnelDialTimeout  = 10 * time.Second
+	tlsRecordHandshake = 0x16
+)
+
+var (
+	// forwardTransport resolves hosts like any other client would, since a rootless daemon never
+	// points them at itself through the hosts file
+	forwardTransport = &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: tunnelDialTimeout}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     http.DefaultTransport.(*http.Transport).IdleConnTimeout,
+		TLSHandshakeTimeout: http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout,
+	}
+	forwardProxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+		},
+		Transport: forwardTransport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("failed to forward proxied request", slog.String("host", r.Host), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+)
+
+// connListener hands connections accepted elsewhere, like intercepted CONNECT tunnels, to an
+// http.Server so they're served and shutdown along with the connections it accepts itself
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// bufferedConn replays bytes already read from a hijacked connection before reading from it
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// handleProxy serves the forward proxy used in rootless mode. Requests for wocked hosts, including
+// https requests tunnelled with CONNECT, are served by the daemon and everything else is passed on.
+func (d *Daemon) handleProxy(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodConnect:
+		d.handleConnect(w, r)
+	case !r.URL.IsAbs() && r.URL.Path == pac.Path:
+		d.servePAC(w, r)
+	case !r.URL.IsAbs():
+		http.Error(w, "wock proxy only serves proxied requests and "+pac.Path, http.StatusBadRequest)
+	case d.isMocked(requestHost(r)):
+		d.handler.ServeHTTP(w, r)
+	default:
+		forwardProxy.ServeHTTP(w, r)
+	}
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(host)
+}
+
+// handleConnect intercepts tunnels to wocked hosts, handing them to the http or https server
+// depending on whether the client starts a tls handshake, and blindly tunnels the rest
+func (d *Daemon) handleConnect(w http.ResponseWriter, r *http.Request) {
+	var upstream net.Conn
+	if !d.isMocked(requestHost(r)) {
+		conn, err := net.DialTimeout("tcp", r.Host, tunnelDialTimeout)
+		if err != nil {
+			slog.Debug("failed to dial tunnel upstream", slog.String("host", r.Host), slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		upstream = conn
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		slog.Error("failed to hijack proxy connection", slog.String("host", r.Host), slog.String("error", err.Error()))
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		if upstream != nil {
+			upstream.Close()
+		}
+		return
+	}
+	client := &bufferedConn{Conn: conn, reader: rw.Reader}
+	if upstream != nil {
+		tunnel(client, upstream)
+		return
+	}
+	// the client speaks first in both http and tls, so waiting on it doesn't hold up the tunnel
+	first, err := client.reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if first[0] == tlsRecordHandshake {
+		d.interceptHttps.push(client)
+	} else {
+		d.interceptHttp.push(client)
+	}
+}
+
+func tunnel(client net.Conn, upstream net.Conn) {
+	defer client.Close()
+	defer upstream.Close()
+	done := make(chan struct{}, 2)
+	copyConn := func(dst net.Conn, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyConn(upstream, client)
+	go copyConn(client, upstream)
+	<-done
+}
+
+func (d *Daemon) servePAC(w http.ResponseWriter, r *http.Request) {
+	d.lock.RLock()
+	var mockedHosts []string
+	for host := range d.mockedHosts {
+		mockedHosts = append(mockedHosts, host)
+	}
+	d.lock.RUnlock()
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	// the pac file points clients back at whichever address they reached the proxy on
+	w.Write([]byte(pac.Generate(r.Host, mockedHosts)))
+}
@@ -0,0 +1,295 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cpendery/wock/config"
+	"github.com/cpendery/wock/fault"
+	"github.com/cpendery/wock/har"
+	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/record"
+	"github.com/cpendery/wock/throttle"
+	"github.com/cpendery/wock/version"
+)
+
+// requestError is a failure caused by the request itself rather than the daemon
+type requestError struct {
+	code model.ErrorCode
+	err  error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// errorCode classifies an error for clients that need to tell failures apart
+func errorCode(err error) model.ErrorCode {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return reqErr.code
+	case errors.Is(err, errHostNotMocked):
+		return model.ErrorCodeHostNotMocked
+	case errors.Is(err, fs.ErrPermission):
+		return model.ErrorCodePermissionDenied
+	default:
+		return model.ErrorCodeInternal
+	}
+}
+
+func decodeRequest(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		slog.Error("invalid message", slog.String("error", err.Error()), slog.String("data", string(data)))
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+	}
+	return nil
+}
+
+// handle carries out a request and returns the data to respond with. Requests from the socket and
+// the admin api are both handled here so they behave the same, other than the caller only being
+// known for requests from the socket.
+func (d *Daemon) handle(msgType model.MessageType, data []byte, caller *model.User) (any, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if msgType != model.StatusMessage && msgType != model.HelloMessage && msgType != model.StopMessage && msgType != model.ProxyMessage {
+		defer d.saveState()
+	}
+	switch msgType {
+	case model.HelloMessage:
+		return model.HelloMessageData{Version: version.Get(), Protocol: model.ProtocolVersion}, nil
+	case model.StatusMessage:
+		return d.status(), nil
+	case model.ProxyMessage:
+		slog.Debug("received proxy message")
+		if err := d.startProxy(); err != nil {
+			slog.Error("failed to start proxy", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("unable to start proxy: %w", err)
+		}
+		return d.status(), nil
+	case model.MockMessage:
+		slog.Debug("received mock message")
+		var mockMessageData model.MockMessageData
+		if err := decodeRequest(data, &mockMessageData); err != nil {
+			return nil, err
+		}
+		return nil, d.mock(mockMessageData, caller)
+	case model.ReplayMessage:
+		slog.Debug("received replay message")
+		var replayMessageData model.ReplayMessageData
+		if err := decodeRequest(data, &replayMessageData); err != nil {
+			return nil, err
+		}
+		return d.replay(replayMessageData)
+	case model.ThrottleMessage:
+		slog.Debug("received throttle message")
+		var throttleMessageData model.ThrottleMessageData
+		if err := decodeRequest(data, &throttleMessageData); err != nil {
+			return nil, err
+		}
+		if err := throttle.Validate(throttleMessageData.Throttle); err != nil {
+			return nil, &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+		}
+		return nil, d.updateMockedHost(throttleMessageData.Host, func(mockedHost *model.MockedHost) {
+			mockedHost.Throttle = throttleMessageData.Throttle
+		})
+	case model.FaultMessage:
+		slog.Debug("received fault message")
+		var faultMessageData model.FaultMessageData
+		if err := decodeRequest(data, &faultMessageData); err != nil {
+			return nil, err
+		}
+		faults, err := fault.Compile(faultMessageData.Faults)
+		if err != nil {
+			return nil, &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+		}
+		return nil, d.updateMockedHost(faultMessageData.Host, func(mockedHost *model.MockedHost) {
+			mockedHost.Faults = faults
+		})
+	case model.ClearMessage:
+		slog.Debug("received clear message")
+		return nil, d.clear()
+	case model.UnmockMessage:
+		slog.Debug("received unmock message")
+		var unmockMessageData model.UnmockMessageData
+		if err := decodeRequest(data, &unmockMessageData); err != nil {
+			return nil, err
+		}
+		return d.removeHosts(unmockMessageData.Hosts)
+	case model.StopMessage:
+		// the caller exits once it has responded
+		slog.Debug("received stop message")
+		if err := d.shutdown(); err != nil {
+			slog.Error("failed to clean up during shutdown", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("daemon stopped but failed to clean up: %w", err)
+		}
+		return nil, nil
+	default:
+		slog.Debug("received unknown message", slog.Int("msgType", int(msgType)))
+		return nil, &requestError{code: model.ErrorCodeUnknownMessageType, err: fmt.Errorf("unknown message type %d", msgType)}
+	}
+}
+
+func (d *Daemon) mock(mockMessageData model.MockMessageData, caller *model.User) error {
+	host := strings.ToLower(strings.TrimSpace(mockMessageData.Host))
+	if !hosts.IsValidHostname(host) {
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: fmt.Errorf("provided host '%s' is an invalid hostname", host)}
+	}
+	if (mockMessageData.Directory == "") == (mockMessageData.Upstream == "") {
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: fmt.Errorf("host %s needs either a directory or an upstream to be served from", host)}
+	}
+	if err := validateMockTarget(mockMessageData); err != nil {
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+	}
+	if err := throttle.Validate(mockMessageData.Throttle); err != nil {
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+	}
+	mockedHost := model.MockedHost{
+		Host:        host,
+		Directory:   mockMessageData.Directory,
+		Upstream:    mockMessageData.Upstream,
+		Passthrough: mockMessageData.Passthrough,
+		SPAFallback: mockMessageData.SPAFallback,
+		Recording:   mockMessageData.Record,
+		Throttle:    mockMessageData.Throttle,
+		ProxyOnly:   mockMessageData.ProxyOnly,
+	}
+	if mockedHost.Recording {
+		recordAs, err := recordingUser(mockedHost.Directory, caller)
+		if err != nil {
+			return &requestError{code: model.ErrorCodePermissionDenied, err: err}
+		}
+		mockedHost.RecordAs = recordAs
+	}
+	if err := d.handler.Register(mockedHost); err != nil {
+		return &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+	}
+	if !mockedHost.ProxyOnly {
+		if err := d.resolveHost(host); err != nil {
+			slog.Error("failed to update hosts file", slog.String("error", err.Error()))
+			return fmt.Errorf("unable to resolve %s: %w", host, err)
+		}
+	}
+	slog.Debug("updated mocked hosts")
+	previous := d.mockedHosts[host]
+	d.mockedHosts[host] = mockedHost
+	if previous.Session != "" && !d.hasSessionHosts(previous.Session) {
+		delete(d.harSessions, previous.Session)
+	}
+	d.events.publish(model.Event{Type: model.EventHostMocked, Host: host, Target: mockedHost.Target()})
+	if err := d.syncResolver(); err != nil {
+		slog.Error("failed to update system resolver", slog.String("error", err.Error()))
+		return fmt.Errorf("unable to update system resolver: %w", err)
+	}
+	return nil
+}
+
+// validateMockTarget checks the directory being served and the options that depend on it, upstreams
+// are validated when they're registered with the handler
+func validateMockTarget(mockMessageData model.MockMessageData) error {
+	if mockMessageData.Upstream != "" {
+		if mockMessageData.Passthrough || mockMessageData.SPAFallback != "" || mockMessageData.Record {
+			return errors.New("passthrough, spa, and recording can only be used with a directory")
+		}
+		return nil
+	}
+	if !filepath.IsAbs(mockMessageData.Directory) {
+		return fmt.Errorf("unable to serve %s as it isn't an absolute path", mockMessageData.Directory)
+	}
+	if _, err := config.IsValidDirectory(mockMessageData.Directory); err != nil {
+		return err
+	}
+	if mockMessageData.SPAFallback != "" {
+		return config.IsValidFallback(mockMessageData.Directory, mockMessageData.SPAFallback)
+	}
+	return nil
+}
+
+// recordingUser is who a recording into the directory is written as. Anyone can reach a root
+// daemon's socket, so it records as the caller and only into directories they own.
+func recordingUser(dir string, caller *model.User) (*model.User, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+	if caller == nil {
+		return nil, errors.New("recording has to be requested over the wock socket when the daemon runs as root")
+	}
+	if err := record.CheckOwner(dir, *caller); err != nil {
+		return nil, err
+	}
+	return caller, nil
+}
+
+func (d *Daemon) replay(replayMessageData model.ReplayMessageData) ([]string, error) {
+	archive, err := har.Load(replayMessageData.Har, replayMessageData.MatchBody)
+	if err != nil {
+		return nil, &requestError{code: model.ErrorCodeInvalidMessage, err: err}
+	}
+	harHosts := archive.Hosts()
+	if len(harHosts) == 0 {
+		return nil, &requestError{code: model.ErrorCodeInvalidMessage, err: fmt.Errorf("%s has no hosts to replay", replayMessageData.Har)}
+	}
+	// replaying a har again reloads it, any other mock of its hosts has to be unwocked first
+	for _, host := range harHosts {
+		if mockedHost, ok := d.mockedHosts[host]; ok && mockedHost.Session != replayMessageData.Har {
+			return nil, &requestError{code: model.ErrorCodeInvalidMessage, err: fmt.Errorf("host %s is already wocked from %s, unwock it before replaying %s", host, mockedHost.Target(), replayMessageData.Har)}
+		}
+	}
+	for _, host := range harHosts {
+		if err := d.resolveHost(host); err != nil {
+			slog.Error("failed to update hosts file", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("unable to resolve %s: %w", host, err)
+		}
+		d.mockedHosts[host] = model.MockedHost{Host: host, Session: replayMessageData.Har}
+		d.handler.Unregister(host)
+		d.events.publish(model.Event{Type: model.EventHostMocked, Host: host, Target: replayMessageData.Har})
+	}
+	d.harSessions[replayMessageData.Har] = archive
+	if err := d.syncResolver(); err != nil {
+		slog.Error("failed to update system resolver", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("unable to update system resolver: %w", err)
+	}
+	return harHosts, nil
+}
+
+func (d *Daemon) clear() error {
+	if err := d.clearHosts(); err != nil {
+		return fmt.Errorf("unable to clear the hosts file: %w", err)
+	}
+	for k := range d.mockedHosts {
+		d.handler.Issuer.Forget(k)
+		d.handler.Unregister(k)
+		delete(d.mockedHosts, k)
+		d.events.publish(model.Event{Type: model.EventHostRemoved, Host: k})
+	}
+	for k := range d.harSessions {
+		delete(d.harSessions, k)
+	}
+	if err := d.syncResolver(); err != nil {
+		return fmt.Errorf("unable to update system resolver: %w", err)
+	}
+	return nil
+}
+
+func (d *Daemon) updateMockedHost(host string, update func(*model.MockedHost)) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	mockedHost, ok := d.mockedHosts[host]
+	if !ok {
+		return fmt.Errorf("host %s %w", host, errHostNotMocked)
+	}
+	update(&mockedHost)
+	d.mockedHosts[host] = mockedHost
+	d.events.publish(model.Event{Type: model.EventHostUpdated, Host: host, Target: mockedHost.Target()})
+	return nil
+}
@@ -0,0 +1,176 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/config"
+	"github.com/cpendery/wock/dns"
+	"github.com/cpendery/wock/fault"
+	"github.com/cpendery/wock/har"
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/throttle"
+)
+
+var (
+	WockStateFile = filepath.Join(xdg.StateHome, "wock", "state.json")
+)
+
+type state struct {
+	Hosts    []model.MockedHost        `json:"hosts"`
+	Sessions []model.ReplayMessageData `json:"sessions,omitempty"`
+}
+
+func (d *Daemon) saveState() {
+	if d.options.Ephemeral {
+		return
+	}
+	s := state{Hosts: []model.MockedHost{}}
+	for _, mockedHost := range d.mockedHosts {
+		s.Hosts = append(s.Hosts, mockedHost)
+	}
+	for session, archive := range d.harSessions {
+		s.Sessions = append(s.Sessions, model.ReplayMessageData{Har: session, MatchBody: archive.MatchesBody()})
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		slog.Error("failed to marshal daemon state", slog.String("error", err.Error()))
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(WockStateFile), 0770); err != nil {
+		slog.Error("failed to create daemon state directory", slog.String("error", err.Error()))
+		return
+	}
+	tmpFile := WockStateFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0660); err != nil {
+		slog.Error("failed to write daemon state", slog.String("error", err.Error()))
+		return
+	}
+	if err := os.Rename(tmpFile, WockStateFile); err != nil {
+		slog.Error("failed to replace daemon state", slog.String("error", err.Error()))
+	}
+}
+
+func loadState() (*state, error) {
+	data, err := os.ReadFile(WockStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return &state{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read daemon state: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal daemon state: %w", err)
+	}
+	return &s, nil
+}
+
+// restoreState reconciles the hosts file, system resolver, and certificates left behind by a
+// previous daemon, re-wocking every persisted host that can still be served and cleaning up the rest
+func (d *Daemon) restoreState() {
+	if err := d.clearHosts(); err != nil {
+		slog.Error("failed to clear stale hosts file entries", slog.String("error", err.Error()))
+	}
+	if !d.options.DNS && !d.options.Rootless {
+		if err := dns.RestoreSystem(); err != nil {
+			slog.Error("failed to clear stale system resolver config", slog.String("error", err.Error()))
+		}
+	}
+
+	if !d.options.Ephemeral {
+		s, err := loadState()
+		if err != nil {
+			slog.Error("failed to load daemon state", slog.String("error", err.Error()))
+			s = &state{}
+		}
+		for _, session := range s.Sessions {
+			archive, err := har.Load(session.Har, session.MatchBody)
+			if err != nil {
+				slog.Info("dropping har session that can't be restored", slog.String("har", session.Har), slog.String("error", err.Error()))
+				continue
+			}
+			d.harSessions[session.Har] = archive
+		}
+		for _, mockedHost := range s.Hosts {
+			faults, err := fault.Compile(mockedHost.Faults)
+			if err == nil {
+				mockedHost.Faults = faults
+				err = canRestore(mockedHost, d.harSessions)
+			}
+			if err != nil {
+				slog.Info("dropping host that can't be restored", slog.String("host", mockedHost.Host), slog.String("error", err.Error()))
+				continue
+			}
+			if err := d.handler.Register(mockedHost); err != nil {
+				slog.Info("dropping host that can't be restored", slog.String("host", mockedHost.Host), slog.String("error", err.Error()))
+				continue
+			}
+			if !mockedHost.ProxyOnly {
+				if err := d.resolveHost(mockedHost.Host); err != nil {
+					slog.Error("failed to update hosts file", slog.String("host", mockedHost.Host), slog.String("error", err.Error()))
+					continue
+				}
+			}
+			slog.Debug("restored mocked host", slog.String("host", mockedHost.Host))
+			d.mockedHosts[mockedHost.Host] = mockedHost
+		}
+		for session := range d.harSessions {
+			if !d.hasSessionHosts(session) {
+				delete(d.harSessions, session)
+			}
+		}
+	}
+	d.saveState()
+
+	if err := d.syncResolver(); err != nil {
+		slog.Error("failed to update system resolver", slog.String("error", err.Error()))
+	}
+	for _, f := range []string{cert.WockCertFile, cert.WockKeyFile} {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("failed to remove stale certificate", slog.String("file", f), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func canRestore(mockedHost model.MockedHost, sessions map[string]*har.Archive) error {
+	if err := throttle.Validate(mockedHost.Throttle); err != nil {
+		return err
+	}
+	if mockedHost.Session != "" {
+		if _, ok := sessions[mockedHost.Session]; !ok {
+			return fmt.Errorf("har session %s wasn't restored", mockedHost.Session)
+		}
+		return nil
+	}
+	if mockedHost.Upstream != "" {
+		return nil
+	}
+	dir, err := config.IsValidDirectory(mockedHost.Directory)
+	if err != nil {
+		return err
+	}
+	if mockedHost.Recording {
+		if _, err := recordingUser(mockedHost.Directory, mockedHost.RecordAs); err != nil {
+			return err
+		}
+	}
+	if mockedHost.SPAFallback != "" {
+		return config.IsValidFallback(*dir, mockedHost.SPAFallback)
+	}
+	return nil
+}
+
+func (d *Daemon) hasSessionHosts(session string) bool {
+	for _, mockedHost := range d.mockedHosts {
+		if mockedHost.Session == session {
+			return true
+		}
+	}
+	return false
+}
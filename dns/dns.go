@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpendery/wock/resolver"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultAddr = "127.0.0.1:53"
+
+	answerTTL      = 5
+	forwardTimeout = 5 * time.Second
+)
+
+// Server answers A/AAAA queries for wocked names with loopback addresses and forwards
+// every other query to the upstream nameservers
+type Server struct {
+	Addr     string
+	Upstream []string
+	// IsMocked reports whether queries for the name should be answered locally
+	IsMocked func(name string) bool
+
+	lock sync.Mutex
+	conn net.PacketConn
+}
+
+func (s *Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen for dns queries: %w", err)
+	}
+	return s.Serve(conn)
+}
+
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.lock.Lock()
+	s.conn = conn
+	s.lock.Unlock()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("unable to read dns query: %w", err)
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go s.handle(conn, query, addr)
+	}
+}
+
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Server) handle(conn net.PacketConn, query []byte, addr net.Addr) {
+	resp, err := s.answer(query)
+	if err != nil {
+		slog.Error("failed to answer dns query", slog.String("error", err.Error()))
+		return
+	}
+	if _, err := conn.WriteTo(resp, addr); err != nil {
+		slog.Error("failed to write dns response", slog.String("error", err.Error()))
+	}
+}
+
+func (s *Server) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse dns query: %w", err)
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse dns question: %w", err)
+	}
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	if question.Class != dnsmessage.ClassINET || !s.IsMocked(name) {
+		ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+		defer cancel()
+		return resolver.Exchange(ctx, s.Upstream, query)
+	}
+
+	slog.Debug("answering dns query for wocked host", slog.String("name", name), slog.String("type", question.Type.String()))
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	resourceHeader := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: answerTTL}
+	switch question.Type {
+	case dnsmessage.TypeA:
+		if err := builder.AResource(resourceHeader, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}); err != nil {
+			return nil, err
+		}
+	case dnsmessage.TypeAAAA:
+		if err := builder.AAAAResource(resourceHeader, dnsmessage.AAAAResource{AAAA: [16]byte(net.IPv6loopback)}); err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+// Domains returns the domains the system resolver should route to the server so that
+// every mocked host, including wildcards, is covered
+func Domains(mockedHosts []string) []string {
+	unique := map[string]struct{}{}
+	var domains []string
+	for _, host := range mockedHosts {
+		domain := strings.TrimPrefix(host, "*.")
+		if _, ok := unique[domain]; !ok {
+			unique[domain] = struct{}{}
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,179 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpendery/wock/hosts"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	upstreamA    = [4]byte{192, 0, 2, 1}
+	upstreamAAAA = [16]byte(netip.MustParseAddr("2001:db8::1").As16())
+)
+
+// startUpstream runs a nameserver that answers every A/AAAA query with documentation addresses
+func startUpstream(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen for upstream: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var parser dnsmessage.Parser
+			header, err := parser.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			question, err := parser.Question()
+			if err != nil {
+				continue
+			}
+			builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true})
+			builder.StartQuestions()
+			builder.Question(question)
+			builder.StartAnswers()
+			resourceHeader := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			switch question.Type {
+			case dnsmessage.TypeA:
+				builder.AResource(resourceHeader, dnsmessage.AResource{A: upstreamA})
+			case dnsmessage.TypeAAAA:
+				builder.AAAAResource(resourceHeader, dnsmessage.AAAAResource{AAAA: upstreamAAAA})
+			}
+			resp, err := builder.Finish()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func startServer(t *testing.T, mockedHosts ...string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen for dns server: %v", err)
+	}
+	server := &Server{
+		Upstream: []string{startUpstream(t)},
+		IsMocked: func(name string) bool {
+			for _, mockedHost := range mockedHosts {
+				if hosts.Matches(mockedHost, name) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	go server.Serve(conn)
+	t.Cleanup(func() { server.Close() })
+	return conn.LocalAddr().String()
+}
+
+func query(t *testing.T, addr string, name string, qtype dnsmessage.Type) dnsmessage.Message {
+	t.Helper()
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	builder.StartQuestions()
+	builder.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name + "."), Type: qtype, Class: dnsmessage.ClassINET})
+	msg, err := builder.Finish()
+	if err != nil {
+		t.Fatalf("unable to build query: %v", err)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("unable to dial dns server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("unable to send query: %v", err)
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("unable to read response: %v", err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		t.Fatalf("unable to parse response: %v", err)
+	}
+	return resp
+}
+
+func TestServerAnswers(t *testing.T) {
+	addr := startServer(t, "app.test", "*.wild.test")
+	tests := []struct {
+		name          string
+		qtype         dnsmessage.Type
+		want          net.IP
+		authoritative bool
+	}{
+		{name: "app.test", qtype: dnsmessage.TypeA, want: net.IPv4(127, 0, 0, 1), authoritative: true},
+		{name: "app.test", qtype: dnsmessage.TypeAAAA, want: net.IPv6loopback, authoritative: true},
+		{name: "APP.test", qtype: dnsmessage.TypeA, want: net.IPv4(127, 0, 0, 1), authoritative: true},
+		{name: "api.wild.test", qtype: dnsmessage.TypeA, want: net.IPv4(127, 0, 0, 1), authoritative: true},
+		{name: "api.wild.test", qtype: dnsmessage.TypeAAAA, want: net.IPv6loopback, authoritative: true},
+		{name: "wild.test", qtype: dnsmessage.TypeA, want: net.IP(upstreamA[:])},
+		{name: "a.b.wild.test", qtype: dnsmessage.TypeA, want: net.IP(upstreamA[:])},
+		{name: "example.com", qtype: dnsmessage.TypeA, want: net.IP(upstreamA[:])},
+		{name: "example.com", qtype: dnsmessage.TypeAAAA, want: net.IP(upstreamAAAA[:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+strings.TrimPrefix(tt.qtype.String(), "Type"), func(t *testing.T) {
+			resp := query(t, addr, tt.name, tt.qtype)
+			if resp.ID != 42 || !resp.Response {
+				t.Fatalf("expected a response to query 42, got id %d response %v", resp.ID, resp.Response)
+			}
+			if resp.Authoritative != tt.authoritative {
+				t.Errorf("expected authoritative %v, got %v", tt.authoritative, resp.Authoritative)
+			}
+			if len(resp.Answers) != 1 {
+				t.Fatalf("expected 1 answer, got %d", len(resp.Answers))
+			}
+			var got net.IP
+			switch body := resp.Answers[0].Body.(type) {
+			case *dnsmessage.AResource:
+				got = body.A[:]
+			case *dnsmessage.AAAAResource:
+				got = body.AAAA[:]
+			default:
+				t.Fatalf("unexpected answer %s", resp.Answers[0].Header.Type)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServerAnswersOtherTypesWithoutRecords(t *testing.T) {
+	addr := startServer(t, "app.test")
+	resp := query(t, addr, "app.test", dnsmessage.TypeMX)
+	if !resp.Authoritative || resp.RCode != dnsmessage.RCodeSuccess {
+		t.Fatalf("expected an authoritative success, got authoritative %v rcode %s", resp.Authoritative, resp.RCode)
+	}
+	if len(resp.Answers) != 0 {
+		t.Errorf("expected no answers, got %d", len(resp.Answers))
+	}
+}
+
+func TestDomains(t *testing.T) {
+	got := Domains([]string{"app.test", "*.app.test", "*.wild.test", "other.test"})
+	want := []string{"app.test", "wild.test", "other.test"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
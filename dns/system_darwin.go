@@ -0,0 +1,56 @@
+//go:build darwin
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	resolverDir = "/etc/resolver"
+	wockTag     = "# source:wock"
+)
+
+// ConfigureSystem routes the domains to the dns server with per-domain /etc/resolver files
+func ConfigureSystem(addr string, domains []string) error {
+	if err := RestoreSystem(); err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid dns address %s: %w", addr, err)
+	}
+	if err := os.MkdirAll(resolverDir, 0755); err != nil {
+		return fmt.Errorf("unable to create resolver directory: %w", err)
+	}
+	for _, domain := range domains {
+		config := fmt.Sprintf("%s\nnameserver %s\nport %s\n", wockTag, host, port)
+		if err := os.WriteFile(filepath.Join(resolverDir, domain), []byte(config), 0644); err != nil {
+			return fmt.Errorf("unable to write resolver for %s: %w", domain, err)
+		}
+	}
+	return nil
+}
+
+// RestoreSystem removes every resolver file written by ConfigureSystem
+func RestoreSystem() error {
+	entries, err := os.ReadDir(resolverDir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		resolverFile := filepath.Join(resolverDir, entry.Name())
+		data, err := os.ReadFile(resolverFile)
+		if err != nil || !strings.HasPrefix(string(data), wockTag) {
+			continue
+		}
+		if err := os.Remove(resolverFile); err != nil {
+			return fmt.Errorf("unable to remove resolver for %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build !darwin && !windows
+
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	systemdResolvedRuntimeDir = "/run/systemd/resolve"
+	systemdResolvedDropIn     = "/etc/systemd/resolved.conf.d/wock.conf"
+	resolvConfFile            = "/etc/resolv.conf"
+	resolvConfBackup          = "/etc/resolv.conf.wock-backup"
+)
+
+func usesSystemdResolved() bool {
+	_, err := os.Stat(systemdResolvedRuntimeDir)
+	return err == nil
+}
+
+func restartSystemdResolved() error {
+	if out, err := exec.Command("systemctl", "restart", "systemd-resolved").CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to restart systemd-resolved: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ConfigureSystem routes the domains to the dns server, using a systemd-resolved drop-in when
+// available and otherwise swapping out resolv.conf
+func ConfigureSystem(addr string, domains []string) error {
+	if len(domains) == 0 {
+		return RestoreSystem()
+	}
+	if usesSystemdResolved() {
+		var routingDomains []string
+		for _, domain := range domains {
+			routingDomains = append(routingDomains, "~"+domain)
+		}
+		config := fmt.Sprintf("# source:wock\n[Resolve]\nDNS=%s\nDomains=%s\n", addr, strings.Join(routingDomains, " "))
+		if err := os.MkdirAll(filepath.Dir(systemdResolvedDropIn), 0755); err != nil {
+			return fmt.Errorf("unable to create systemd-resolved config directory: %w", err)
+		}
+		if err := os.WriteFile(systemdResolvedDropIn, []byte(config), 0644); err != nil {
+			return fmt.Errorf("unable to write systemd-resolved config: %w", err)
+		}
+		return restartSystemdResolved()
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid dns address %s: %w", addr, err)
+	}
+	if port != "53" {
+		return fmt.Errorf("resolv.conf can only use a dns server on port 53, not %s", port)
+	}
+	if _, err := os.Stat(resolvConfBackup); errors.Is(err, os.ErrNotExist) {
+		original, err := os.ReadFile(resolvConfFile)
+		if err != nil {
+			return fmt.Errorf("unable to read resolv.conf: %w", err)
+		}
+		if err := os.WriteFile(resolvConfBackup, original, 0644); err != nil {
+			return fmt.Errorf("unable to back up resolv.conf: %w", err)
+		}
+	}
+	config := fmt.Sprintf("# source:wock, original saved to %s\nnameserver %s\n", resolvConfBackup, host)
+	// resolv.conf is often a symlink into a resolver's runtime directory, which is replaced
+	// rather than written through
+	if err := os.Remove(resolvConfFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to replace resolv.conf: %w", err)
+	}
+	if err := os.WriteFile(resolvConfFile, []byte(config), 0644); err != nil {
+		return fmt.Errorf("unable to write resolv.conf: %w", err)
+	}
+	return nil
+}
+
+// RestoreSystem undoes any resolver changes made by ConfigureSystem
+func RestoreSystem() error {
+	if _, err := os.Stat(systemdResolvedDropIn); err == nil {
+		if err := os.Remove(systemdResolvedDropIn); err != nil {
+			return fmt.Errorf("unable to remove systemd-resolved config: %w", err)
+		}
+		if usesSystemdResolved() {
+			return restartSystemdResolved()
+		}
+	}
+	if original, err := os.ReadFile(resolvConfBackup); err == nil {
+		if err := os.Remove(resolvConfFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to replace resolv.conf: %w", err)
+		}
+		if err := os.WriteFile(resolvConfFile, original, 0644); err != nil {
+			return fmt.Errorf("unable to restore resolv.conf: %w", err)
+		}
+		return os.Remove(resolvConfBackup)
+	}
+	return nil
+}
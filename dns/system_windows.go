@@ -0,0 +1,17 @@
+//go:build windows
+
+package dns
+
+import "errors"
+
+var (
+	ErrUnsupported = errors.New("pointing the system resolver at wock's dns server isn't supported on windows")
+)
+
+func ConfigureSystem(_ string, _ []string) error {
+	return ErrUnsupported
+}
+
+func RestoreSystem() error {
+	return nil
+}
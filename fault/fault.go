@@ -0,0 +1,208 @@
+package fault
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/cpendery/wock/model"
+)
+
+type kind int
+
+const (
+	none kind = iota
+	errorStatus
+	reset
+	truncate
+	hang
+)
+
+// Validate checks that the profile's rates are percentages that add up to at most 100
+func Validate(p model.FaultProfile) error {
+	total := 0.0
+	for _, rate := range []float64{p.ErrorRate, p.ResetRate, p.TruncateRate, p.HangRate} {
+		if rate < 0 || rate > 100 {
+			return fmt.Errorf("fault rate %v must be a percentage between 0 and 100", rate)
+		}
+		total += rate
+	}
+	if total > 100 {
+		return fmt.Errorf("fault rates add up to %v%%, which is more than 100%%", total)
+	}
+	if p.ErrorRate > 0 && (p.ErrorStatus < 500 || p.ErrorStatus > 599) {
+		return fmt.Errorf("fault error status %d must be a 5xx status", p.ErrorStatus)
+	}
+	for _, glob := range p.Paths {
+		if !strings.HasPrefix(glob, "/") {
+			return fmt.Errorf("fault path '%s' must start with '/'", glob)
+		}
+	}
+	return nil
+}
+
+// Compile validates the profile and compiles its path globs, the compiled profile is the one that
+// should be kept on the mocked host
+func Compile(p model.FaultProfile) (model.FaultProfile, error) {
+	if err := Validate(p); err != nil {
+		return p, err
+	}
+	p.PathPatterns = compileGlobs(p.Paths)
+	return p, nil
+}
+
+func Describe(p model.FaultProfile) string {
+	var parts []string
+	if p.ErrorRate > 0 {
+		parts = append(parts, fmt.Sprintf("%v%% %d", p.ErrorRate, p.ErrorStatus))
+	}
+	if p.ResetRate > 0 {
+		parts = append(parts, fmt.Sprintf("%v%% reset", p.ResetRate))
+	}
+	if p.TruncateRate > 0 {
+		parts = append(parts, fmt.Sprintf("%v%% truncate", p.TruncateRate))
+	}
+	if p.HangRate > 0 {
+		parts = append(parts, fmt.Sprintf("%v%% hang", p.HangRate))
+	}
+	if len(parts) != 0 && len(p.Paths) != 0 {
+		parts = append(parts, fmt.Sprintf("on %s", strings.Join(p.Paths, " ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// globToRegexp converts a path glob where '*' matches any characters, including '/'
+func globToRegexp(glob string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	if len(globs) == 0 {
+		return nil
+	}
+	patterns := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		patterns = append(patterns, globToRegexp(glob))
+	}
+	return patterns
+}
+
+func appliesTo(p model.FaultProfile, urlPath string) bool {
+	if len(p.PathPatterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.PathPatterns {
+		if pattern.MatchString(urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func roll(p model.FaultProfile) kind {
+	n := rand.Float64() * 100
+	for _, fault := range []struct {
+		kind kind
+		rate float64
+	}{{errorStatus, p.ErrorRate}, {reset, p.ResetRate}, {truncate, p.TruncateRate}, {hang, p.HangRate}} {
+		if n < fault.rate {
+			return fault.kind
+		}
+		n -= fault.rate
+	}
+	return none
+}
+
+// Wrap injects the profile's faults into responses served by next
+func Wrap(p model.FaultProfile, next http.Handler) http.Handler {
+	if !p.Enabled() {
+		return next
+	}
+	if len(p.PathPatterns) != len(p.Paths) {
+		p.PathPatterns = compileGlobs(p.Paths)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !appliesTo(p, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch roll(p) {
+		case errorStatus:
+			slog.Debug("injecting error fault", slog.String("host", r.Host), slog.String("path", r.URL.Path), slog.Int("status", p.ErrorStatus))
+			http.Error(w, http.StatusText(p.ErrorStatus), p.ErrorStatus)
+		case hang:
+			slog.Debug("injecting hang fault", slog.String("host", r.Host), slog.String("path", r.URL.Path))
+			<-r.Context().Done()
+		case reset:
+			slog.Debug("injecting reset fault", slog.String("host", r.Host), slog.String("path", r.URL.Path))
+			aw := &abortWriter{ResponseWriter: w, reset: true}
+			next.ServeHTTP(aw, r)
+			aw.abort()
+		case truncate:
+			slog.Debug("injecting truncate fault", slog.String("host", r.Host), slog.String("path", r.URL.Path))
+			aw := &abortWriter{ResponseWriter: w}
+			next.ServeHTTP(aw, r)
+			aw.abort()
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// abortWriter writes part of the first chunk of the body and then kills the connection,
+// either with a TCP reset or by closing it before the body is complete
+type abortWriter struct {
+	http.ResponseWriter
+	reset   bool
+	aborted bool
+}
+
+func (w *abortWriter) Write(b []byte) (int, error) {
+	if w.aborted {
+		return 0, net.ErrClosed
+	}
+	n, err := w.ResponseWriter.Write(b[:len(b)/2])
+	if err != nil {
+		return n, err
+	}
+	w.abort()
+	return 0, net.ErrClosed
+}
+
+func (w *abortWriter) abort() {
+	if w.aborted {
+		return
+	}
+	w.aborted = true
+	rc := http.NewResponseController(w.ResponseWriter)
+	rc.Flush()
+	conn, _, err := rc.Hijack()
+	if err != nil {
+		// connections that can't be hijacked (e.g. http/2) have their stream reset instead
+		panic(http.ErrAbortHandler)
+	}
+	if w.reset {
+		if tcpConn, ok := netConn(conn).(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+	}
+	conn.Close()
+}
+
+func netConn(conn net.Conn) net.Conn {
+	if c, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		return c.NetConn()
+	}
+	return conn
+}
+
+func (w *abortWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
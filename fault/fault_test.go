@@ -0,0 +1,120 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cpendery/wock/model"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile model.FaultProfile
+		wantErr bool
+	}{
+		{name: "empty", profile: model.FaultProfile{}},
+		{name: "error", profile: model.FaultProfile{ErrorRate: 10, ErrorStatus: 503}},
+		{name: "every fault", profile: model.FaultProfile{ErrorRate: 25, ErrorStatus: 500, ResetRate: 25, TruncateRate: 25, HangRate: 25}},
+		{name: "paths", profile: model.FaultProfile{ResetRate: 5, Paths: []string{"/api/*", "/users/?"}}},
+		{name: "negative rate", profile: model.FaultProfile{ResetRate: -1}, wantErr: true},
+		{name: "rate over 100", profile: model.FaultProfile{HangRate: 101}, wantErr: true},
+		{name: "rates over 100", profile: model.FaultProfile{ResetRate: 60, TruncateRate: 41}, wantErr: true},
+		{name: "error without status", profile: model.FaultProfile{ErrorRate: 10}, wantErr: true},
+		{name: "non 5xx status", profile: model.FaultProfile{ErrorRate: 10, ErrorStatus: 404}, wantErr: true},
+		{name: "relative path", profile: model.FaultProfile{ResetRate: 5, Paths: []string{"api/*"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.profile); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate returned error %v", tt.name, err)
+		}
+		if _, err := Compile(tt.profile); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Compile returned error %v", tt.name, err)
+		}
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	tests := []struct {
+		paths []string
+		path  string
+		want  bool
+	}{
+		{paths: nil, path: "/anything", want: true},
+		{paths: []string{"/api/*"}, path: "/api/users/1", want: true},
+		{paths: []string{"/api/*"}, path: "/apiv2", want: false},
+		{paths: []string{"/users/?"}, path: "/users/1", want: true},
+		{paths: []string{"/users/?"}, path: "/users/10", want: false},
+		{paths: []string{"/a.json"}, path: "/a.json", want: true},
+		{paths: []string{"/a.json"}, path: "/abjson", want: false},
+		{paths: []string{"/health", "/api/*"}, path: "/health", want: true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(model.FaultProfile{ResetRate: 1, Paths: tt.paths})
+		if err != nil {
+			t.Fatalf("unable to compile %v: %v", tt.paths, err)
+		}
+		if len(p.PathPatterns) != len(tt.paths) {
+			t.Errorf("expected %d compiled patterns, got %d", len(tt.paths), len(p.PathPatterns))
+		}
+		if got := appliesTo(p, tt.path); got != tt.want {
+			t.Errorf("appliesTo(%v, %s) = %v, want %v", tt.paths, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRoll(t *testing.T) {
+	const rolls = 10_000
+	tests := []struct {
+		name    string
+		profile model.FaultProfile
+		// want is the expected percentage of rolls for each kind, give or take tolerance
+		want map[kind]float64
+	}{
+		{name: "disabled", profile: model.FaultProfile{}, want: map[kind]float64{none: 100}},
+		{name: "always error", profile: model.FaultProfile{ErrorRate: 100, ErrorStatus: 503}, want: map[kind]float64{errorStatus: 100}},
+		{name: "always hang", profile: model.FaultProfile{HangRate: 100}, want: map[kind]float64{hang: 100}},
+		{
+			name:    "split",
+			profile: model.FaultProfile{ErrorRate: 20, ErrorStatus: 500, ResetRate: 30, TruncateRate: 10},
+			want:    map[kind]float64{errorStatus: 20, reset: 30, truncate: 10, none: 40},
+		},
+	}
+	const tolerance = 3.0
+	for _, tt := range tests {
+		counts := map[kind]int{}
+		for i := 0; i < rolls; i++ {
+			counts[roll(tt.profile)]++
+		}
+		for k := range counts {
+			if _, ok := tt.want[k]; !ok {
+				t.Errorf("%s: unexpected fault %d rolled %d times", tt.name, k, counts[k])
+			}
+		}
+		for k, want := range tt.want {
+			got := float64(counts[k]) * 100 / rolls
+			if got < want-tolerance || got > want+tolerance {
+				t.Errorf("%s: expected fault %d about %v%% of the time, got %v%%", tt.name, k, want, got)
+			}
+		}
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	p, err := Compile(model.FaultProfile{ErrorRate: 100, ErrorStatus: 503, Paths: []string{"/api/*"}})
+	if err != nil {
+		t.Fatalf("unable to compile profile: %v", err)
+	}
+	handler := Wrap(p, next)
+	for path, want := range map[string]int{"/api/users": http.StatusServiceUnavailable, "/index.html": http.StatusOK} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("expected %s to return %d, got %d", path, want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cpendery/wock/hosts"
+)
+
+var (
+	// headers that describe the original transfer rather than the recorded content
+	skippedHeaders = []string{"content-length", "content-encoding", "transfer-encoding", "connection", "keep-alive"}
+)
+
+type Archive struct {
+	Log struct {
+		Entries []Entry `json:"entries"`
+	} `json:"log"`
+
+	matchBody bool
+	served    map[string]int
+	lock      sync.Mutex
+}
+
+type Entry struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	PostData *PostData `json:"postData,omitempty"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Headers []NameValue `json:"headers"`
+	Content Content     `json:"content"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Content struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Load reads the HAR file, optionally requiring request bodies to match when replaying
+func Load(harPath string, matchBody bool) (*Archive, error) {
+	data, err := os.ReadFile(harPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read har file: %w", err)
+	}
+	archive := Archive{matchBody: matchBody, served: map[string]int{}}
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal har file: %w", err)
+	}
+	return &archive, nil
+}
+
+func (a *Archive) MatchesBody() bool {
+	return a.matchBody
+}
+
+// Hosts returns every hostname the archive has a recorded response for
+func (a *Archive) Hosts() []string {
+	unique := map[string]struct{}{}
+	for _, entry := range a.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if host == "" || host == "localhost" || net.ParseIP(host) != nil || !hosts.IsValidHostname(host) {
+			continue
+		}
+		unique[host] = struct{}{}
+	}
+	var result []string
+	for host := range unique {
+		result = append(result, host)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func requestKey(method string, u *url.URL) string {
+	return fmt.Sprintf("%s %s%s?%s", strings.ToUpper(method), strings.ToLower(u.Hostname()), u.EscapedPath(), u.Query().Encode())
+}
+
+func (a *Archive) find(r *http.Request, body string) *Entry {
+	key := requestKey(r.Method, &url.URL{Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery})
+	var matches []*Entry
+	for i := range a.Log.Entries {
+		entry := &a.Log.Entries[i]
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil || requestKey(entry.Request.Method, u) != key {
+			continue
+		}
+		if a.matchBody {
+			var recordedBody string
+			if entry.Request.PostData != nil {
+				recordedBody = entry.Request.PostData.Text
+			}
+			if recordedBody != body {
+				continue
+			}
+		}
+		matches = append(matches, entry)
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// repeated requests are answered in the order they were recorded, sticking on the last response
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	served := a.served[key]
+	a.served[key] = served + 1
+	if served >= len(matches) {
+		served = len(matches) - 1
+	}
+	return matches[served]
+}
+
+// Serve answers the request with its recorded response, returning false if the
+// archive doesn't contain a matching request
+func (a *Archive) Serve(w http.ResponseWriter, r *http.Request) (bool, error) {
+	var body string
+	if a.matchBody && r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return false, fmt.Errorf("unable to read request body: %w", err)
+		}
+		body = string(data)
+	}
+	entry := a.find(r, body)
+	if entry == nil {
+		return false, nil
+	}
+	content := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+		if err != nil {
+			return false, fmt.Errorf("unable to decode recorded response: %w", err)
+		}
+		content = decoded
+	}
+	for _, header := range entry.Response.Headers {
+		name := strings.ToLower(header.Name)
+		if strings.HasPrefix(name, ":") || slices.Contains(skippedHeaders, name) {
+			continue
+		}
+		w.Header().Add(header.Name, header.Value)
+	}
+	if w.Header().Get("Content-Type") == "" && entry.Response.Content.MimeType != "" {
+		w.Header().Set("Content-Type", entry.Response.Content.MimeType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	status := entry.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, err := w.Write(content)
+		return true, err
+	}
+	return true, nil
+}
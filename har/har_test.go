@@ -0,0 +1,162 @@
+package har
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func entry(method, url, body string, status int, text string) Entry {
+	e := Entry{
+		Request:  Request{Method: method, URL: url},
+		Response: Response{Status: status, Content: Content{MimeType: "text/plain", Text: text}},
+	}
+	if body != "" {
+		e.Request.PostData = &PostData{MimeType: "application/json", Text: body}
+	}
+	return e
+}
+
+// load writes the entries to a har file and loads it back
+func load(t *testing.T, matchBody bool, entries ...Entry) *Archive {
+	t.Helper()
+	var archive Archive
+	archive.Log.Entries = entries
+	data, err := json.Marshal(&archive)
+	if err != nil {
+		t.Fatalf("unable to marshal har: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "recorded.har")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("unable to write har: %v", err)
+	}
+	loaded, err := Load(path, matchBody)
+	if err != nil {
+		t.Fatalf("unable to load har: %v", err)
+	}
+	return loaded
+}
+
+func serve(t *testing.T, archive *Archive, r *http.Request) (bool, *httptest.ResponseRecorder) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	served, err := archive.Serve(rec, r)
+	if err != nil {
+		t.Fatalf("unable to serve %s %s: %v", r.Method, r.URL, err)
+	}
+	return served, rec
+}
+
+func TestServeMatching(t *testing.T) {
+	entries := []Entry{
+		entry(http.MethodGet, "https://api.example.com/users?page=2&sort=name", "", http.StatusOK, "page two"),
+		entry(http.MethodGet, "https://api.example.com/users", "", http.StatusOK, "page one"),
+		entry(http.MethodPost, "https://api.example.com/users", `{"name":"ada"}`, http.StatusCreated, "created ada"),
+		entry(http.MethodPost, "https://api.example.com/users", `{"name":"bob"}`, http.StatusConflict, "bob exists"),
+		entry(http.MethodGet, "https://api.example.com/missing", "", http.StatusNotFound, "recorded not found"),
+		entry(http.MethodGet, "https://api.example.com/unset", "", 0, "no status"),
+	}
+	tests := []struct {
+		name      string
+		matchBody bool
+		method    string
+		url       string
+		body      string
+		// wantBody is empty when the request shouldn't match
+		wantBody   string
+		wantStatus int
+	}{
+		{name: "path", method: http.MethodGet, url: "http://api.example.com/users", wantBody: "page one", wantStatus: http.StatusOK},
+		{name: "query", method: http.MethodGet, url: "http://api.example.com/users?page=2&sort=name", wantBody: "page two", wantStatus: http.StatusOK},
+		{name: "query order", method: http.MethodGet, url: "http://api.example.com/users?sort=name&page=2", wantBody: "page two", wantStatus: http.StatusOK},
+		{name: "other query", method: http.MethodGet, url: "http://api.example.com/users?page=3"},
+		{name: "host case", method: http.MethodGet, url: "http://API.example.com/users", wantBody: "page one", wantStatus: http.StatusOK},
+		{name: "other host", method: http.MethodGet, url: "http://app.example.com/users"},
+		{name: "other path", method: http.MethodGet, url: "http://api.example.com/user"},
+		{name: "method", method: http.MethodDelete, url: "http://api.example.com/users"},
+		{name: "body ignored", method: http.MethodPost, url: "http://api.example.com/users", body: `{"name":"bob"}`, wantBody: "created ada", wantStatus: http.StatusCreated},
+		{name: "body", matchBody: true, method: http.MethodPost, url: "http://api.example.com/users", body: `{"name":"bob"}`, wantBody: "bob exists", wantStatus: http.StatusConflict},
+		{name: "other body", matchBody: true, method: http.MethodPost, url: "http://api.example.com/users", body: `{"name":"eve"}`},
+		{name: "recorded status", method: http.MethodGet, url: "http://api.example.com/missing", wantBody: "recorded not found", wantStatus: http.StatusNotFound},
+		{name: "missing status", method: http.MethodGet, url: "http://api.example.com/unset", wantBody: "no status", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := load(t, tt.matchBody, entries...)
+			served, rec := serve(t, archive, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			if served != (tt.wantBody != "") {
+				t.Fatalf("expected served %v, got %v", tt.wantBody != "", served)
+			}
+			if !served {
+				return
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got)
+			}
+		})
+	}
+}
+
+func TestServeRepeatedRequests(t *testing.T) {
+	archive := load(t, false,
+		entry(http.MethodGet, "https://api.example.com/poll", "", http.StatusAccepted, "pending"),
+		entry(http.MethodGet, "https://api.example.com/poll", "", http.StatusOK, "done"),
+	)
+	for _, want := range []string{"pending", "done", "done"} {
+		_, rec := serve(t, archive, httptest.NewRequest(http.MethodGet, "http://api.example.com/poll", nil))
+		if got := rec.Body.String(); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestServeResponse(t *testing.T) {
+	recorded := entry(http.MethodGet, "https://api.example.com/logo.png", "", http.StatusOK, "aGVsbG8=")
+	recorded.Response.Content = Content{MimeType: "image/png", Text: "aGVsbG8=", Encoding: "base64"}
+	recorded.Response.Headers = []NameValue{
+		{Name: "X-Request-Id", Value: "1"},
+		{Name: "Content-Encoding", Value: "gzip"},
+		{Name: "Content-Length", Value: "999"},
+		{Name: ":status", Value: "200"},
+	}
+	archive := load(t, false, recorded)
+	_, rec := serve(t, archive, httptest.NewRequest(http.MethodGet, "http://api.example.com/logo.png", nil))
+	if got := rec.Body.String(); got != "hello" {
+		t.Errorf("expected the decoded body, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("expected the recorded mime type, got %q", got)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "5" {
+		t.Errorf("expected the content length of the decoded body, got %q", got)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "1" {
+		t.Errorf("expected the recorded header, got %q", got)
+	}
+	if rec.Header().Get("Content-Encoding") != "" || rec.Header().Get(":status") != "" {
+		t.Errorf("expected transfer headers to be skipped, got %v", rec.Header())
+	}
+}
+
+func TestHosts(t *testing.T) {
+	archive := load(t, false,
+		entry(http.MethodGet, "https://api.example.com/users", "", http.StatusOK, ""),
+		entry(http.MethodGet, "https://API.example.com/posts", "", http.StatusOK, ""),
+		entry(http.MethodGet, "https://cdn.example.com:8443/app.js", "", http.StatusOK, ""),
+		entry(http.MethodGet, "http://localhost:3000/", "", http.StatusOK, ""),
+		entry(http.MethodGet, "http://127.0.0.1/", "", http.StatusOK, ""),
+		entry(http.MethodGet, "data:text/plain,hello", "", http.StatusOK, ""),
+	)
+	want := []string{"api.example.com", "cdn.example.com"}
+	if got := archive.Hosts(); !slices.Equal(got, want) {
+		t.Errorf("expected hosts %v, got %v", want, got)
+	}
+}
@@ -1,7 +1,6 @@
 package hosts
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"log"
@@ -19,16 +18,29 @@ const (
 	unixHostsFile   = "/etc/hosts"
 
 	wockSourceTag = "source:wock"
+	// wockDisabledTag marks a user's own line that wock commented out while it wocks the host
+	wockDisabledTag = "disabled-by:wock"
+	disabledPrefix  = "# "
+	disabledSuffix  = "   # " + wockDisabledTag
+	// wockKeptTag marks the copy of a disabled line that keeps its other hosts resolving, it
+	// directly follows the disabled line
+	wockKeptTag = "kept-by:wock"
+	keptSuffix  = "   # " + wockKeptTag
 )
 
 var (
 	hostnameRegex = regexp.MustCompile(`(?i)^(\*\.)?[0-9a-z_-]([0-9a-z._-]*[0-9a-z_-])?$`)
+	// hostsFile replaces the system's hosts file when set, for tests
+	hostsFile string
 )
 
 type UpdateResult struct {
 }
 
 func hostFile() string {
+	if hostsFile != "" {
+		return hostsFile
+	}
 	var hostFilePath string
 
 	switch runtime.GOOS {
@@ -51,89 +63,194 @@ func IsValidHostname(host string) bool {
 	return hostnameRegex.MatchString(asciiHost)
 }
 
-func ClearHosts() error {
-	hostFilePath := hostFile()
-	file, err := os.Open(hostFilePath)
-	if err != nil {
-		return fmt.Errorf("unable to open hosts file: %w", err)
+// Matches reports whether the host is covered by the mocked host, where a wildcard
+// like *.example.com covers a single label as it does in certificates
+func Matches(mockedHost string, host string) bool {
+	if mockedHost == host {
+		return true
 	}
-	scanner := bufio.NewScanner(file)
-	var result bytes.Buffer
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, wockSourceTag) {
-			continue
+	suffix, ok := strings.CutPrefix(mockedHost, "*.")
+	if !ok {
+		return false
+	}
+	label, rest, found := strings.Cut(host, ".")
+	return found && label != "" && rest == suffix
+}
+
+// parseLine returns the address and hostnames the hosts file line maps, ignoring comments
+func parseLine(line string) (string, []string) {
+	content, _, _ := strings.Cut(line, "#")
+	fields := strings.Fields(content)
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+// lineHasHost reports whether the hosts file line maps the host, ignoring comments
+func lineHasHost(line string, host string) bool {
+	_, names := parseLine(line)
+	for _, name := range names {
+		if strings.EqualFold(name, host) {
+			return true
 		}
-		result.WriteString(line)
-		result.WriteRune('\n')
 	}
+	return false
+}
 
-	err = file.Close()
-	if err != nil {
-		return fmt.Errorf("unable to close hosts file on initial read: %w", err)
+// isWockLine reports whether wock wrote the line, including the commented out lines older versions
+// of wock left behind
+func isWockLine(line string) bool {
+	return strings.Contains(line, wockSourceTag)
+}
+
+// disableLine comments out a user's own line so it can be restored once wock stops wocking the host
+func disableLine(line string) string {
+	return disabledPrefix + line + disabledSuffix
+}
+
+// enabledLine returns the user's original line if wock disabled it
+func enabledLine(line string) (string, bool) {
+	original, ok := strings.CutSuffix(line, disabledSuffix)
+	if !ok {
+		return "", false
 	}
-	file, err = os.Create(hostFilePath)
-	if err != nil {
-		return fmt.Errorf("unable to open hosts file for truncation: %w", err)
+	return strings.TrimPrefix(original, disabledPrefix), true
+}
+
+func isKeptLine(line string) bool {
+	return strings.HasSuffix(line, keptSuffix)
+}
+
+// userLines returns the lines for the user's original line while wock wocks some of its hosts. The
+// original is disabled and followed by a kept line with the hosts that aren't wocked, if any.
+func userLines(original string, wocked map[string]bool) []string {
+	if len(wocked) == 0 {
+		return []string{original}
 	}
-	_, err = file.Write(result.Bytes())
-	if err != nil {
-		return fmt.Errorf("unable to overwrite hosts file: %w", err)
+	address, names := parseLine(original)
+	var kept []string
+	for _, name := range names {
+		if !wocked[strings.ToLower(name)] {
+			kept = append(kept, name)
+		}
 	}
-	err = file.Close()
-	if err != nil {
-		return fmt.Errorf("unable to close hosts file on overwrite: %w", err)
+	if len(kept) == 0 {
+		return []string{disableLine(original)}
 	}
-	return nil
+	return []string{disableLine(original), address + " " + strings.Join(kept, " ") + keptSuffix}
 }
 
-func UpdateHosts(host string, enable bool) error {
-	hostFilePath := hostFile()
-	file, err := os.Open(hostFilePath)
+// wockedHosts returns the hosts of the disabled original that wock is wocking, which are the ones
+// missing from its kept line
+func wockedHosts(original string, kept string) map[string]bool {
+	_, keptNames := parseLine(kept)
+	wocked := map[string]bool{}
+	_, names := parseLine(original)
+	for _, name := range names {
+		wocked[strings.ToLower(name)] = true
+	}
+	for _, name := range keptNames {
+		delete(wocked, strings.ToLower(name))
+	}
+	return wocked
+}
+
+func wockLine(host string) string {
+	return fmt.Sprintf("127.0.0.1 %s   # %s", host, wockSourceTag)
+}
+
+// readHosts returns the lines of the hosts file and the line ending it uses
+func readHosts() ([]string, string, error) {
+	data, err := os.ReadFile(hostFile())
 	if err != nil {
-		return fmt.Errorf("unable to open hosts file: %w", err)
+		return nil, "", fmt.Errorf("unable to read hosts file: %w", err)
+	}
+	eol := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		eol = "\r\n"
 	}
-	scanner := bufio.NewScanner(file)
-	hasWrittenHost := false
+	content := strings.TrimSuffix(string(data), eol)
+	if content == "" {
+		return nil, eol, nil
+	}
+	return strings.Split(content, eol), eol, nil
+}
+
+func writeHosts(lines []string, eol string) error {
 	var result bytes.Buffer
-	for scanner.Scan() {
-		line := scanner.Text()
-		cleanedLine := strings.ToLower(strings.TrimSpace(line))
-		if strings.Contains(cleanedLine, host) {
-			if enable {
-				result.WriteString(fmt.Sprintf("127.0.0.1 %s   # %s\n", host, wockSourceTag))
-			} else {
-				result.WriteString(fmt.Sprintf("# 127.0.0.1 %s   %s\n", host, wockSourceTag))
-			}
-			hasWrittenHost = true
-		} else {
-			result.WriteString(line)
-			result.WriteRune('\n')
-		}
+	for _, line := range lines {
+		result.WriteString(line)
+		result.WriteString(eol)
 	}
-	if !hasWrittenHost {
-		if enable {
-			result.WriteString(fmt.Sprintf("127.0.0.1 %s   # %s\n", host, wockSourceTag))
-		} else {
-			result.WriteString(fmt.Sprintf("# 127.0.0.1 %s   %s\n", host, wockSourceTag))
-		}
+	if err := os.WriteFile(hostFile(), result.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to overwrite hosts file: %w", err)
 	}
+	return nil
+}
 
-	err = file.Close()
+// ClearHosts removes every line wock added and restores the lines it disabled
+func ClearHosts() error {
+	lines, eol, err := readHosts()
 	if err != nil {
-		return fmt.Errorf("unable to close hosts file on initial read: %w", err)
+		return err
 	}
-	file, err = os.Create(hostFilePath)
-	if err != nil {
-		return fmt.Errorf("unable to open hosts file for truncation: %w", err)
+	var result []string
+	for _, line := range lines {
+		if original, ok := enabledLine(line); ok {
+			result = append(result, original)
+		} else if !isWockLine(line) && !isKeptLine(line) {
+			result = append(result, line)
+		}
 	}
-	_, err = file.Write(result.Bytes())
+	return writeHosts(result, eol)
+}
+
+// UpdateHosts points the host at loopback when enabled, and otherwise removes wock's line for it.
+// The user's own lines for the host are commented out while it's wocked, with the line's other
+// hosts kept on a line of their own, and are restored exactly once none of their hosts are wocked.
+func UpdateHosts(host string, enable bool) error {
+	lines, eol, err := readHosts()
 	if err != nil {
-		return fmt.Errorf("unable to overwrite hosts file: %w", err)
+		return err
 	}
-	err = file.Close()
-	if err != nil {
-		return fmt.Errorf("unable to close hosts file on overwrite: %w", err)
+	host = strings.ToLower(host)
+	var result []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if isWockLine(line) {
+			if !lineHasHost(strings.TrimLeft(line, "# "), host) {
+				result = append(result, line)
+			}
+			continue
+		}
+		original, disabled := enabledLine(line)
+		if !disabled && (!enable || !lineHasHost(line, host)) {
+			result = append(result, line)
+			continue
+		}
+		wocked := map[string]bool{}
+		if disabled {
+			kept := ""
+			if i+1 < len(lines) && isKeptLine(lines[i+1]) {
+				kept = lines[i+1]
+				i++
+			}
+			wocked = wockedHosts(original, kept)
+		} else {
+			original = line
+		}
+		if lineHasHost(original, host) {
+			if enable {
+				wocked[host] = true
+			} else {
+				delete(wocked, host)
+			}
+		}
+		result = append(result, userLines(original, wocked)...)
 	}
-	return nil
+	if enable {
+		result = append(result, wockLine(host))
+	}
+	return writeHosts(result, eol)
 }
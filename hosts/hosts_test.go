@@ -0,0 +1,199 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type update struct {
+	host   string
+	enable bool
+}
+
+// useHostsFile points the package at a temporary hosts file with the content
+func useHostsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("unable to write hosts file: %v", err)
+	}
+	hostsFile = path
+	t.Cleanup(func() { hostsFile = "" })
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read hosts file: %v", err)
+	}
+	return string(data)
+}
+
+func TestUpdateHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   string
+		updates []update
+		want    string
+	}{
+		{
+			name:    "enable",
+			hosts:   "127.0.0.1 localhost\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "127.0.0.1 localhost\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "enable twice",
+			hosts:   "127.0.0.1 localhost\n",
+			updates: []update{{"api.example.com", true}, {"api.example.com", true}},
+			want:    "127.0.0.1 localhost\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "enable empty file",
+			hosts:   "",
+			updates: []update{{"api.example.com", true}},
+			want:    "127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "disable",
+			hosts:   "127.0.0.1 localhost\n127.0.0.1 api.example.com   # source:wock\n",
+			updates: []update{{"api.example.com", false}},
+			want:    "127.0.0.1 localhost\n",
+		},
+		{
+			name:    "disable unwocked host",
+			hosts:   "127.0.0.1 localhost\n10.0.0.5 api.example.com\n",
+			updates: []update{{"api.example.com", false}},
+			want:    "127.0.0.1 localhost\n10.0.0.5 api.example.com\n",
+		},
+		{
+			name:    "user line",
+			hosts:   "10.0.0.5 api.example.com # staging\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "# 10.0.0.5 api.example.com # staging   # disabled-by:wock\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "user line in another case",
+			hosts:   "10.0.0.5 API.example.com\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "# 10.0.0.5 API.example.com   # disabled-by:wock\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "multi host line",
+			hosts:   "10.0.0.5\tapi.example.com app.example.com\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "# 10.0.0.5\tapi.example.com app.example.com   # disabled-by:wock\n10.0.0.5 app.example.com   # kept-by:wock\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "multi host line with every host wocked",
+			hosts:   "10.0.0.5 api.example.com app.example.com\n",
+			updates: []update{{"api.example.com", true}, {"app.example.com", true}},
+			want:    "# 10.0.0.5 api.example.com app.example.com   # disabled-by:wock\n127.0.0.1 api.example.com   # source:wock\n127.0.0.1 app.example.com   # source:wock\n",
+		},
+		{
+			name:    "multi host line with one host unwocked",
+			hosts:   "10.0.0.5 api.example.com app.example.com\n",
+			updates: []update{{"api.example.com", true}, {"app.example.com", true}, {"api.example.com", false}},
+			want:    "# 10.0.0.5 api.example.com app.example.com   # disabled-by:wock\n10.0.0.5 api.example.com   # kept-by:wock\n127.0.0.1 app.example.com   # source:wock\n",
+		},
+		{
+			name:    "commented out user line",
+			hosts:   "# 10.0.0.5 api.example.com\n#10.0.0.6 api.example.com\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "# 10.0.0.5 api.example.com\n#10.0.0.6 api.example.com\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "host only in a comment",
+			hosts:   "10.0.0.5 app.example.com # was api.example.com\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "10.0.0.5 app.example.com # was api.example.com\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "similar hosts",
+			hosts:   "10.0.0.5 api.example.com.au myapi.example.com\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "10.0.0.5 api.example.com.au myapi.example.com\n127.0.0.1 api.example.com   # source:wock\n",
+		},
+		{
+			name:    "windows line endings",
+			hosts:   "127.0.0.1 localhost\r\n10.0.0.5 api.example.com app.example.com\r\n",
+			updates: []update{{"api.example.com", true}},
+			want:    "127.0.0.1 localhost\r\n# 10.0.0.5 api.example.com app.example.com   # disabled-by:wock\r\n10.0.0.5 app.example.com   # kept-by:wock\r\n127.0.0.1 api.example.com   # source:wock\r\n",
+		},
+		{
+			name:    "commented out wock line from older versions",
+			hosts:   "# 127.0.0.1 api.example.com   # source:wock\n",
+			updates: []update{{"api.example.com", false}},
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := useHostsFile(t, tt.hosts)
+			for _, u := range tt.updates {
+				if err := UpdateHosts(u.host, u.enable); err != nil {
+					t.Fatalf("unable to update %s: %v", u.host, err)
+				}
+			}
+			if got := readFile(t, path); got != tt.want {
+				t.Errorf("unexpected hosts file\nwant %q\ngot  %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateHostsRoundTrip(t *testing.T) {
+	original := "127.0.0.1 localhost\n" +
+		"# 10.0.0.4 api.example.com\n" +
+		"10.0.0.5\tapi.example.com app.example.com   # staging\n" +
+		"10.0.0.6 API.example.com\n" +
+		"::1 app.example.com cdn.example.com\n"
+	tests := []struct {
+		name    string
+		updates []update
+	}{
+		{name: "single host", updates: []update{{"api.example.com", true}, {"api.example.com", false}}},
+		{name: "same order", updates: []update{{"api.example.com", true}, {"app.example.com", true}, {"api.example.com", false}, {"app.example.com", false}}},
+		{name: "reverse order", updates: []update{{"api.example.com", true}, {"app.example.com", true}, {"app.example.com", false}, {"api.example.com", false}}},
+		{name: "every host", updates: []update{
+			{"cdn.example.com", true}, {"api.example.com", true}, {"app.example.com", true},
+			{"app.example.com", false}, {"cdn.example.com", false}, {"api.example.com", false},
+		}},
+		{name: "repeated", updates: []update{{"app.example.com", true}, {"app.example.com", true}, {"app.example.com", false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := useHostsFile(t, original)
+			for _, u := range tt.updates {
+				if err := UpdateHosts(u.host, u.enable); err != nil {
+					t.Fatalf("unable to update %s: %v", u.host, err)
+				}
+			}
+			if got := readFile(t, path); got != original {
+				t.Errorf("expected the hosts file to be restored\nwant %q\ngot  %q", original, got)
+			}
+		})
+	}
+}
+
+func TestClearHosts(t *testing.T) {
+	original := "127.0.0.1 localhost\n" +
+		"# 10.0.0.4 api.example.com\n" +
+		"10.0.0.5 api.example.com app.example.com\n" +
+		"10.0.0.6 cdn.example.com\n"
+	path := useHostsFile(t, original)
+	for _, host := range []string{"api.example.com", "cdn.example.com", "new.example.com"} {
+		if err := UpdateHosts(host, true); err != nil {
+			t.Fatalf("unable to update %s: %v", host, err)
+		}
+	}
+	if err := ClearHosts(); err != nil {
+		t.Fatalf("unable to clear hosts: %v", err)
+	}
+	if got := readFile(t, path); got != original {
+		t.Errorf("expected the hosts file to be restored\nwant %q\ngot  %q", original, got)
+	}
+}
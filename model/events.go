@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+type EventType string
+
+const (
+	EventHostMocked  EventType = "hostMocked"
+	EventHostUpdated EventType = "hostUpdated"
+	EventHostRemoved EventType = "hostRemoved"
+	EventCertIssued  EventType = "certIssued"
+	EventListening   EventType = "listening"
+	EventRequest     EventType = "request"
+	EventStopped     EventType = "stopped"
+)
+
+// Event is something that happened in the daemon, only the fields relevant to its type are set
+type Event struct {
+	Time       time.Time     `json:"time"`
+	Type       EventType     `json:"type"`
+	Host       string        `json:"host,omitempty"`
+	Target     string        `json:"target,omitempty"`
+	CertExpiry *time.Time    `json:"certExpiry,omitempty"`
+	Listener   *Listener     `json:"listener,omitempty"`
+	Request    *RequestEvent `json:"request,omitempty"`
+}
+
+// RequestEvent describes a request served for a wocked host
+type RequestEvent struct {
+	Remote  string        `json:"remote,omitempty"`
+	Method  string        `json:"method"`
+	Path    string        `json:"path"`
+	Proto   string        `json:"proto,omitempty"`
+	Status  int           `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Bytes   int64         `json:"bytes"`
+	// TLS is the tls version the request was made over, empty for plain http
+	TLS string `json:"tls,omitempty"`
+	// Source is what answered the request, e.g. a file, an upstream, or a har archive
+	Source string `json:"source,omitempty"`
+}
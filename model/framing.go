@@ -0,0 +1,65 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// ProtocolVersion is bumped whenever messages change incompatibly, so a client and daemon
+	// from different versions of wock notice instead of misreading each other
+	ProtocolVersion uint8 = 2
+	maxFrameSize          = 64 << 20
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+)
+
+// WriteMessage writes the message as a frame made up of the protocol version, the payload length
+// as a big endian uint32, and the json encoded message
+func WriteMessage(w io.Writer, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("unable to marshal message: %w", err)
+	}
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("message of %d bytes exceeds the maximum frame size", len(payload))
+	}
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = ProtocolVersion
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	if _, err := w.Write(append(frame, payload...)); err != nil {
+		return fmt.Errorf("unable to write message: %w", err)
+	}
+	return nil
+}
+
+// ReadMessage reads a single frame written by WriteMessage. Frames from other protocol versions
+// are still decoded, since the frame header never changes, but come with ErrUnsupportedVersion
+// so only messages that are stable across versions are acted on.
+func ReadMessage(r io.Reader) (Message, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Message{}, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return Message{}, fmt.Errorf("message of %d bytes exceeds the maximum frame size", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Message{}, fmt.Errorf("unable to read message: %w", err)
+	}
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return Message{}, fmt.Errorf("unable to unmarshal message: %w", err)
+	}
+	if header[0] != ProtocolVersion {
+		return msg, fmt.Errorf("%w %d, expected %d", ErrUnsupportedVersion, header[0], ProtocolVersion)
+	}
+	return msg, nil
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+// frame builds a raw frame with the given version and length header around the payload
+func frame(version uint8, size uint32, payload []byte) []byte {
+	header := make([]byte, 5)
+	header[0] = version
+	binary.BigEndian.PutUint32(header[1:], size)
+	return append(header, payload...)
+}
+
+func TestWriteReadMessage(t *testing.T) {
+	var buf bytes.Buffer
+	messages := []Message{
+		{Id: "1", MsgType: HelloMessage, Data: []byte(`{"version":"dev"}`)},
+		{Id: "2", MsgType: StatusMessage},
+	}
+	for _, msg := range messages {
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("unable to write message: %v", err)
+		}
+	}
+	for _, want := range messages {
+		got, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("unable to read message: %v", err)
+		}
+		if got.Id != want.Id || got.MsgType != want.MsgType || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+	if _, err := ReadMessage(&buf); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF once the stream ends, got %v", err)
+	}
+}
+
+func TestWriteMessageOversize(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMessage(&buf, Message{MsgType: MockMessage, Data: make([]byte, maxFrameSize)})
+	if err == nil {
+		t.Fatal("expected an error writing a message over the maximum frame size")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	payload, err := json.Marshal(Message{Id: "1", MsgType: StopMessage})
+	if err != nil {
+		t.Fatalf("unable to marshal message: %v", err)
+	}
+	tests := []struct {
+		name    string
+		frame   []byte
+		wantErr error
+		// wantMsg is whether the message is still decoded alongside the error
+		wantMsg bool
+	}{
+		{name: "empty stream", frame: nil, wantErr: io.EOF},
+		{name: "truncated header", frame: frame(ProtocolVersion, uint32(len(payload)), nil)[:3], wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated payload", frame: frame(ProtocolVersion, uint32(len(payload)), payload[:len(payload)-1]), wantErr: io.ErrUnexpectedEOF},
+		{name: "missing payload", frame: frame(ProtocolVersion, uint32(len(payload)), nil), wantErr: io.EOF},
+		{name: "oversize frame", frame: frame(ProtocolVersion, maxFrameSize+1, payload)},
+		{name: "invalid payload", frame: frame(ProtocolVersion, 3, []byte("{{{"))},
+		{name: "older version", frame: frame(ProtocolVersion-1, uint32(len(payload)), payload), wantErr: ErrUnsupportedVersion, wantMsg: true},
+		{name: "newer version", frame: frame(ProtocolVersion+1, uint32(len(payload)), payload), wantErr: ErrUnsupportedVersion, wantMsg: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ReadMessage(bytes.NewReader(tt.frame))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if decoded := msg.Id == "1" && msg.MsgType == StopMessage; decoded != tt.wantMsg {
+				t.Errorf("expected the message to be decoded %v, got %+v", tt.wantMsg, msg)
+			}
+		})
+	}
+}
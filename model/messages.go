@@ -1,30 +1,191 @@
 package model
 
+import (
+	"regexp"
+	"time"
+)
+
 type Message struct {
-	MsgType  MessageType `json:"msgType"`
-	ClientId string      `json:"clientId,omitempty"`
-	Data     []byte      `json:"data,omitempty"`
+	// Id pairs a response with its request, so a client can have several requests in flight
+	Id      string      `json:"id"`
+	MsgType MessageType `json:"msgType"`
+	Data    []byte      `json:"data,omitempty"`
 }
 
 type MessageType int32
 
 const (
-	StopMessage    MessageType = 0
-	StatusMessage  MessageType = 1
-	MockMessage    MessageType = 2
-	UnmockMessage  MessageType = 3
-	ClearMessage   MessageType = 4
-	SuccessMessage MessageType = 5
-	ErrorMessage   MessageType = 6
-	TimeoutMessage MessageType = 7
+	StopMessage     MessageType = 0
+	StatusMessage   MessageType = 1
+	MockMessage     MessageType = 2
+	UnmockMessage   MessageType = 3
+	ClearMessage    MessageType = 4
+	SuccessMessage  MessageType = 5
+	ErrorMessage    MessageType = 6
+	ReplayMessage   MessageType = 8
+	ThrottleMessage MessageType = 9
+	FaultMessage    MessageType = 10
+	HelloMessage    MessageType = 11
+	// SubscribeMessage streams the daemon's events back as EventMessages tagged with its id, until
+	// the client disconnects
+	SubscribeMessage MessageType = 12
+	EventMessage     MessageType = 13
+	// ProxyMessage starts the daemon's forward proxy if it isn't running yet and responds with the
+	// daemon's status
+	ProxyMessage MessageType = 14
+	// APITokenMessage responds with the admin api's token, it's only answered over the socket
+	APITokenMessage MessageType = 15
+)
+
+// HelloMessageData is exchanged when a client connects. It and StopMessage have to stay the same
+// across protocol versions, so a daemon left running by another version can still be identified
+// and replaced.
+type HelloMessageData struct {
+	Version  string `json:"version"`
+	Protocol uint8  `json:"protocol"`
+}
+
+type ErrorCode string
+
+const (
+	ErrorCodeInternal            ErrorCode = "internal"
+	ErrorCodeInvalidMessage      ErrorCode = "invalidMessage"
+	ErrorCodeUnknownMessageType  ErrorCode = "unknownMessageType"
+	ErrorCodeUnsupportedProtocol ErrorCode = "unsupportedProtocol"
+	ErrorCodeHostNotMocked       ErrorCode = "hostNotMocked"
+	ErrorCodePermissionDenied    ErrorCode = "permissionDenied"
 )
 
+type ErrorMessageData struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
 type MockedHost struct {
-	Host      string
-	Directory string
+	Host        string       `json:"host"`
+	Directory   string       `json:"directory,omitempty"`
+	Upstream    string       `json:"upstream,omitempty"`
+	Passthrough bool         `json:"passthrough,omitempty"`
+	SPAFallback string       `json:"spaFallback,omitempty"`
+	Recording   bool         `json:"recording,omitempty"`
+	Session     string       `json:"session,omitempty"`
+	Throttle    Throttle     `json:"throttle,omitempty"`
+	Faults      FaultProfile `json:"faults,omitempty"`
+	ProxyOnly   bool         `json:"proxyOnly,omitempty"`
+	// RecordAs is the user a recording is written as when the daemon runs as root, the one who
+	// asked for it
+	RecordAs *User `json:"recordAs,omitempty"`
+}
+
+// User identifies a local user
+type User struct {
+	Uid int `json:"uid"`
+	Gid int `json:"gid"`
+}
+
+func (m MockedHost) TargetType() string {
+	if m.Session != "" {
+		return "har"
+	}
+	if m.Recording {
+		return "recording"
+	}
+	if m.Upstream != "" {
+		return "upstream"
+	}
+	return "directory"
+}
+
+func (m MockedHost) Target() string {
+	if m.Session != "" {
+		return m.Session
+	}
+	if m.Upstream != "" {
+		return m.Upstream
+	}
+	return m.Directory
+}
+
+type DaemonStatus struct {
+	Online    bool         `json:"online"`
+	Pid       int          `json:"pid,omitempty"`
+	Version   string       `json:"version,omitempty"`
+	StartedAt *time.Time   `json:"startedAt,omitempty"`
+	Uptime    string       `json:"uptime,omitempty"`
+	Listeners []Listener   `json:"listeners,omitempty"`
+	Hosts     []HostStatus `json:"hosts"`
+}
+
+type APITokenMessageData struct {
+	Token string `json:"token"`
+}
+
+type Listener struct {
+	Protocol string `json:"protocol"`
+	Addr     string `json:"addr"`
+}
+
+type HostStatus struct {
+	MockedHost
+	Type       string     `json:"type"`
+	CertExpiry *time.Time `json:"certExpiry,omitempty"`
+	Requests   uint64     `json:"requests"`
 }
 
 type MockMessageData struct {
-	Host      string `json:"host"`
-	Directory string `json:"dir"`
+	Host        string   `json:"host"`
+	Directory   string   `json:"dir,omitempty"`
+	Upstream    string   `json:"upstream,omitempty"`
+	Passthrough bool     `json:"passthrough,omitempty"`
+	SPAFallback string   `json:"spaFallback,omitempty"`
+	Record      bool     `json:"record,omitempty"`
+	Throttle    Throttle `json:"throttle,omitempty"`
+	// ProxyOnly serves the host only to clients of the forward proxy, leaving the hosts file and
+	// system resolver alone
+	ProxyOnly bool `json:"proxyOnly,omitempty"`
+}
+
+type UnmockMessageData struct {
+	Hosts []string `json:"hosts"`
+}
+
+type ReplayMessageData struct {
+	Har       string `json:"har"`
+	MatchBody bool   `json:"matchBody,omitempty"`
+}
+
+type Throttle struct {
+	LatencyMin time.Duration `json:"latencyMin,omitempty"`
+	LatencyMax time.Duration `json:"latencyMax,omitempty"`
+	TTFB       time.Duration `json:"ttfb,omitempty"`
+	Bandwidth  int64         `json:"bandwidthBps,omitempty"`
+}
+
+func (t Throttle) Enabled() bool {
+	return t.LatencyMax > 0 || t.TTFB > 0 || t.Bandwidth > 0
+}
+
+type ThrottleMessageData struct {
+	Host     string   `json:"host"`
+	Throttle Throttle `json:"throttle"`
+}
+
+type FaultProfile struct {
+	ErrorRate    float64  `json:"errorRate,omitempty"`
+	ErrorStatus  int      `json:"errorStatus,omitempty"`
+	ResetRate    float64  `json:"resetRate,omitempty"`
+	TruncateRate float64  `json:"truncateRate,omitempty"`
+	HangRate     float64  `json:"hangRate,omitempty"`
+	Paths        []string `json:"paths,omitempty"`
+	// PathPatterns are the compiled Paths, set by fault.Compile so requests don't recompile them
+	PathPatterns []*regexp.Regexp `json:"-"`
+}
+
+func (f FaultProfile) Enabled() bool {
+	return f.ErrorRate > 0 || f.ResetRate > 0 || f.TruncateRate > 0 || f.HangRate > 0
+}
+
+type FaultMessageData struct {
+	Host   string       `json:"host"`
+	Faults FaultProfile `json:"faults"`
 }
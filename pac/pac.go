@@ -0,0 +1,37 @@
+package pac
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Path is where the rootless daemon's proxy serves its PAC file
+const Path = "/proxy.pac"
+
+// Generate builds a proxy auto-config file sending the wocked hosts through the proxy and
+// everything else directly, falling back to a direct connection if the proxy is down
+func Generate(proxyAddr string, hosts []string) string {
+	sorted := append([]string{}, hosts...)
+	sort.Strings(sorted)
+	var conditions []string
+	for _, host := range sorted {
+		if strings.HasPrefix(host, "*.") {
+			// wildcards cover exactly one label, while shExpMatch's * also matches dots
+			conditions = append(conditions, fmt.Sprintf("(shExpMatch(host, %q) && dnsDomainLevels(host) == %d)", host, strings.Count(host, ".")))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("host === %q", host))
+		}
+	}
+	var b strings.Builder
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	if len(conditions) != 0 {
+		fmt.Fprintf(&b, "  if (%s) {\n", strings.Join(conditions, " ||\n      "))
+		fmt.Fprintf(&b, "    return %q;\n", fmt.Sprintf("PROXY %s; DIRECT", proxyAddr))
+		b.WriteString("  }\n")
+	}
+	b.WriteString("  return \"DIRECT\";\n")
+	b.WriteString("}\n")
+	return b.String()
+}
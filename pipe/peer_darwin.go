@@ -0,0 +1,38 @@
+//go:build darwin
+
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerCredentials returns the user and group of the process on the other end of a connection to
+// the daemon's socket
+func PeerCredentials(conn net.Conn) (int, int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, 0, errors.New("unable to check the peer of a connection that isn't a unix socket")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", err)
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", err)
+	}
+	if credErr != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", credErr)
+	}
+	if cred.Ngroups == 0 {
+		return 0, 0, errors.New("unable to check peer credentials: the peer has no group")
+	}
+	return int(cred.Uid), int(cred.Groups[0]), nil
+}
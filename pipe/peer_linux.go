@@ -0,0 +1,35 @@
+//go:build linux
+
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// PeerCredentials returns the user and group of the process on the other end of a connection to
+// the daemon's socket
+func PeerCredentials(conn net.Conn) (int, int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, 0, errors.New("unable to check the peer of a connection that isn't a unix socket")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", err)
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", err)
+	}
+	if credErr != nil {
+		return 0, 0, fmt.Errorf("unable to check peer credentials: %w", credErr)
+	}
+	return int(cred.Uid), int(cred.Gid), nil
+}
@@ -3,6 +3,7 @@ package pipe
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"time"
 )
@@ -11,6 +12,27 @@ const (
 	defaultTimeout = 1 * time.Second
 )
 
+var (
+	rootless bool
+)
+
+// UseRootless points the client and daemon at the current user's own socket rather than the
+// system daemon's
+func UseRootless() {
+	rootless = true
+}
+
+// DialServer connects to the daemon, waiting up to the timeout for it to start listening
+func DialServer(timeout *time.Duration) (net.Conn, error) {
+	dialTimeout := defaultTimeout
+	if timeout != nil {
+		dialTimeout = *timeout
+	}
+	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(dialTimeout))
+	defer cancelCtx()
+	return DialContext(ctx, Path())
+}
+
 func waitForFile(filePath string, ctx context.Context) error {
 	sleepChan := make(chan struct{})
 	for {
@@ -7,54 +7,86 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"syscall"
-	"time"
+
+	"github.com/adrg/xdg"
 )
 
 const (
-	wockSocket             = "/tmp/wock"
-	wockClientSocketPrefix = "/tmp/wock"
+	// DefaultPath is the socket the system daemon listens on, which every user can connect to
+	DefaultPath = "/tmp/wock"
+
+	rootlessSocket = "wock.sock"
 )
 
-func DialServer(timeout *time.Duration) (net.Conn, error) {
-	dialTimeout := defaultTimeout
-	if timeout != nil {
-		dialTimeout = *timeout
+// Path is the socket the daemon listens on, a rootless daemon's socket lives in the user's runtime
+// directory, or a private temp directory when they don't have one
+func Path() string {
+	if !rootless {
+		return DefaultPath
 	}
-	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(dialTimeout))
-	defer cancelCtx()
-	if err := waitForFile(wockSocket, ctx); err != nil {
-		return nil, err
+	if info, err := os.Stat(xdg.RuntimeDir); err == nil && info.IsDir() {
+		return filepath.Join(xdg.RuntimeDir, "wock", rootlessSocket)
 	}
-	return net.Dial("unix", wockSocket)
+	return filepath.Join(os.TempDir(), fmt.Sprintf("wock-%d", os.Getuid()), rootlessSocket)
 }
 
-func DialClient(clientId string) (net.Conn, error) {
-	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(defaultTimeout))
-	defer cancelCtx()
-	clientSocket := fmt.Sprintf("%s-%s", wockClientSocketPrefix, clientId)
-	if err := waitForFile(clientSocket, ctx); err != nil {
+// DialContext connects to the daemon listening on the socket at path, waiting for the socket to be
+// created until the context is done
+func DialContext(ctx context.Context, path string) (net.Conn, error) {
+	if err := waitForFile(path, ctx); err != nil {
 		return nil, err
 	}
-	return net.Dial("unix", clientSocket)
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", path)
 }
 
 func ServerListen() (net.Listener, error) {
-	oldUmask := syscall.Umask(0)
-	listener, err := net.Listen("unix", wockSocket)
+	if !rootless {
+		oldUmask := syscall.Umask(0)
+		listener, err := net.Listen("unix", DefaultPath)
+		syscall.Umask(oldUmask)
+		return listener, err
+	}
+	path := Path()
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	oldUmask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
 	syscall.Umask(oldUmask)
 	return listener, err
 }
 
-func ClientListen(clientId string) (net.Listener, error) {
-	oldUmask := syscall.Umask(0)
-	listener, err := net.Listen("unix", fmt.Sprintf("%s-%s", wockClientSocketPrefix, clientId))
-	syscall.Umask(oldUmask)
-	return listener, err
+// LegacyClientListen listens on the socket daemons from before the handshake answer the client on,
+// they dial it next to the daemon's socket at path
+func LegacyClientListen(path string, clientId string) (net.Listener, error) {
+	return net.Listen("unix", fmt.Sprintf("%s-%s", path, clientId))
+}
+
+// privateDir creates the directory only the current user can access, refusing one that someone
+// else created first
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create socket directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("unable to check socket directory: %w", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("unable to use socket directory %s as it isn't owned by the current user", dir)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return fmt.Errorf("unable to restrict socket directory: %w", err)
+	}
+	return nil
 }
 
 func Teardown() error {
-	return os.Remove(wockSocket)
+	return os.Remove(Path())
 }
 
 func IsServerPipeOpen() bool {
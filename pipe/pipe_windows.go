@@ -4,56 +4,54 @@ package pipe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
-	"time"
 
 	winio "github.com/Microsoft/go-winio"
 )
 
 const (
-	wockServerPipe = `\\.\pipe\wock`
+	// DefaultPath is the named pipe the daemon listens on
+	DefaultPath = `\\.\pipe\wock`
 )
 
-func DialServer(timeout *time.Duration) (net.Conn, error) {
-	dialTimeout := defaultTimeout
-	if timeout != nil {
-		dialTimeout = *timeout
-	}
-	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(dialTimeout))
-	defer cancelCtx()
-	if err := waitForFile(wockServerPipe, ctx); err != nil {
-		return nil, err
-	}
-	return winio.DialPipeContext(ctx, wockServerPipe)
+// Path is the named pipe the daemon listens on
+func Path() string {
+	return DefaultPath
 }
 
-func DialClient(clientId string) (net.Conn, error) {
-	ctx, cancelCtx := context.WithDeadline(context.Background(), time.Now().Add(defaultTimeout))
-	defer cancelCtx()
-
-	clientPipe := fmt.Sprintf("%s-%s", wockServerPipe, clientId)
-	if err := waitForFile(wockServerPipe, ctx); err != nil {
+// DialContext connects to the daemon listening on the named pipe at path, waiting for the pipe to be
+// created until the context is done
+func DialContext(ctx context.Context, path string) (net.Conn, error) {
+	if err := waitForFile(path, ctx); err != nil {
 		return nil, err
 	}
-	return winio.DialPipeContext(ctx, clientPipe)
+	return winio.DialPipeContext(ctx, path)
 }
 
 func ServerListen() (net.Listener, error) {
-	return winio.ListenPipe(wockServerPipe, &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
+	return winio.ListenPipe(DefaultPath, &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
+}
+
+// LegacyClientListen listens on the named pipe daemons from before the handshake answer the client
+// on, they dial it next to the daemon's pipe at path
+func LegacyClientListen(path string, clientId string) (net.Listener, error) {
+	return winio.ListenPipe(fmt.Sprintf("%s-%s", path, clientId), &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
 }
 
-func ClientListen(clientId string) (net.Listener, error) {
-	return winio.ListenPipe(fmt.Sprintf("%s-%s", wockServerPipe, clientId), &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
+// PeerCredentials isn't supported for named pipes, which don't identify their clients by user id
+func PeerCredentials(conn net.Conn) (int, int, error) {
+	return 0, 0, errors.New("peer credentials aren't supported on windows")
 }
 
 func Teardown() error {
-	return os.Remove(wockServerPipe)
+	return os.Remove(DefaultPath)
 }
 
 func IsServerPipeOpen() bool {
-	l, err := winio.ListenPipe(wockServerPipe, &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
+	l, err := winio.ListenPipe(DefaultPath, &winio.PipeConfig{SecurityDescriptor: "D:P(A;;GA;;;AU)"})
 	if err != nil {
 		return true
 	}
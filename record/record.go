@@ -0,0 +1,299 @@
+package record
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cpendery/wock/model"
+)
+
+const (
+	MetadataSuffix = ".wock.json"
+
+	indexFile = "index.html"
+)
+
+var (
+	// headers that are recomputed or only make sense for the original response
+	skippedHeaders = []string{"Content-Length", "Connection", "Date", "Keep-Alive", "Transfer-Encoding"}
+	writeLock      sync.Mutex
+)
+
+type Metadata struct {
+	Variants []Variant `json:"variants"`
+}
+
+type Variant struct {
+	Method string      `json:"method"`
+	Query  string      `json:"query,omitempty"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+func (v Variant) matches(method string, query url.Values) bool {
+	return v.Method == method && v.Query == query.Encode()
+}
+
+// bodyPath maps a request path to the file its default (GET without a query) response is stored in
+func bodyPath(dir string, urlPath string) string {
+	cleaned := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") || cleaned == "/" {
+		return filepath.Join(dir, filepath.FromSlash(cleaned), indexFile)
+	}
+	p := filepath.Join(dir, filepath.FromSlash(cleaned))
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return filepath.Join(p, indexFile)
+	}
+	return p
+}
+
+func variantFile(defaultFile string, method string, query url.Values) string {
+	if method == http.MethodGet && len(query) == 0 {
+		return filepath.Base(defaultFile)
+	}
+	sum := sha1.Sum([]byte(query.Encode()))
+	return fmt.Sprintf("%s~%s~%s", filepath.Base(defaultFile), strings.ToLower(method), hex.EncodeToString(sum[:4]))
+}
+
+func readMetadata(metadataPath string) (*Metadata, error) {
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal recording metadata %s: %w", metadataPath, err)
+	}
+	return &metadata, nil
+}
+
+// Record tees the response body into the directory as it's streamed to the client. The body and
+// a metadata sidecar holding its status, headers, and the method/query variant it answered are
+// saved at the request's path once the whole body has been read, so interrupted responses aren't
+// recorded. Files are written as the user when one is given.
+func Record(dir string, user *model.User, resp *http.Response) error {
+	var f *os.File
+	err := asUser(user, func() (err error) {
+		f, err = os.CreateTemp(dir, ".wock-recording-*")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create recorded body: %w", err)
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, file: f, dir: dir, user: user, resp: resp}
+	return nil
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	file     *os.File
+	dir      string
+	user     *model.User
+	resp     *http.Response
+	complete bool
+	err      error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.err == nil {
+		_, b.err = b.file.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if closeErr := b.file.Close(); b.err == nil {
+		b.err = closeErr
+	}
+	switch {
+	case b.err != nil:
+		slog.Error("failed to record response", slog.String("host", b.resp.Request.Host), slog.String("path", b.resp.Request.URL.Path), slog.String("error", b.err.Error()))
+		b.remove()
+	case !b.complete:
+		slog.Debug("skipped recording an incomplete response", slog.String("host", b.resp.Request.Host), slog.String("path", b.resp.Request.URL.Path))
+		b.remove()
+	default:
+		if err := asUser(b.user, func() error { return save(b.dir, b.resp.Request, b.resp, b.file.Name()) }); err != nil {
+			slog.Error("failed to record response", slog.String("host", b.resp.Request.Host), slog.String("path", b.resp.Request.URL.Path), slog.String("error", err.Error()))
+			b.remove()
+		}
+	}
+	return err
+}
+
+// remove drops a recorded body that won't be saved
+func (b *recordingBody) remove() {
+	asUser(b.user, func() error { return os.Remove(b.file.Name()) })
+}
+
+// save moves the recorded body into place and adds its variant to the metadata sidecar
+func save(dir string, r *http.Request, resp *http.Response, recordedBody string) error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	defaultFile := bodyPath(dir, r.URL.Path)
+	if err := makeDirs(dir, filepath.Dir(defaultFile)); err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	bodyFile := variantFile(defaultFile, r.Method, query)
+	if err := os.Rename(recordedBody, filepath.Join(filepath.Dir(defaultFile), bodyFile)); err != nil {
+		return fmt.Errorf("unable to write recorded body: %w", err)
+	}
+
+	metadataPath := defaultFile + MetadataSuffix
+	metadata, err := readMetadata(metadataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		metadata = &Metadata{}
+	} else if err != nil {
+		return err
+	}
+	header := resp.Header.Clone()
+	for _, skipped := range skippedHeaders {
+		header.Del(skipped)
+	}
+	variant := Variant{Method: r.Method, Query: query.Encode(), Status: resp.StatusCode, Header: header, Body: bodyFile}
+	replaced := false
+	for i := range metadata.Variants {
+		if metadata.Variants[i].matches(r.Method, query) {
+			metadata.Variants[i] = variant
+			replaced = true
+		}
+	}
+	if !replaced {
+		metadata.Variants = append(metadata.Variants, variant)
+	}
+	return writeMetadata(metadataPath, metadata)
+}
+
+func writeMetadata(metadataPath string, metadata *Metadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal recording metadata: %w", err)
+	}
+	if err := os.WriteFile(metadataPath, data, 0644); err != nil {
+		return fmt.Errorf("unable to write recording metadata: %w", err)
+	}
+	return nil
+}
+
+// makeDirs creates the directories down to target, which is inside of dir. A path recorded as a
+// file (e.g. /users) is moved into a directory of its own (users/index.html) once a path beneath
+// it (e.g. /users/1) is recorded.
+func makeDirs(dir string, target string) error {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	current := dir
+	for _, segment := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, segment)
+		info, err := os.Stat(current)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if err := os.Mkdir(current, 0755); err != nil {
+				return fmt.Errorf("unable to create recording directory: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("unable to create recording directory: %w", err)
+		case !info.IsDir():
+			if err := moveIntoDirectory(current); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveIntoDirectory turns a recorded file into a directory holding it as its index, along with
+// its variants and metadata
+func moveIntoDirectory(file string) error {
+	parent, name := filepath.Dir(file), filepath.Base(file)
+	moved := file + ".wock-moving"
+	if err := os.Rename(file, moved); err != nil {
+		return fmt.Errorf("unable to move %s into a directory: %w", file, err)
+	}
+	if err := os.Mkdir(file, 0755); err != nil {
+		return fmt.Errorf("unable to move %s into a directory: %w", file, err)
+	}
+	if err := os.Rename(moved, filepath.Join(file, indexFile)); err != nil {
+		return fmt.Errorf("unable to move %s into a directory: %w", file, err)
+	}
+	metadataPath := filepath.Join(parent, name+MetadataSuffix)
+	metadata, err := readMetadata(metadataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i, variant := range metadata.Variants {
+		body := filepath.Base(variant.Body)
+		if body == name {
+			metadata.Variants[i].Body = indexFile
+			continue
+		}
+		suffix, ok := strings.CutPrefix(body, name+"~")
+		if !ok {
+			continue
+		}
+		metadata.Variants[i].Body = indexFile + "~" + suffix
+		if err := os.Rename(filepath.Join(parent, body), filepath.Join(file, metadata.Variants[i].Body)); err != nil {
+			return fmt.Errorf("unable to move %s into a directory: %w", body, err)
+		}
+	}
+	if err := writeMetadata(filepath.Join(file, indexFile+MetadataSuffix), metadata); err != nil {
+		return err
+	}
+	return os.Remove(metadataPath)
+}
+
+// Replay serves the recorded variant matching the request, returning false if nothing
+// was recorded for it
+func Replay(dir string, w http.ResponseWriter, r *http.Request) (bool, error) {
+	defaultFile := bodyPath(dir, r.URL.Path)
+	metadata, err := readMetadata(defaultFile + MetadataSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	query := r.URL.Query()
+	for _, variant := range metadata.Variants {
+		if !variant.matches(r.Method, query) {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(filepath.Dir(defaultFile), filepath.Base(variant.Body)))
+		if err != nil {
+			return false, fmt.Errorf("unable to read recorded body: %w", err)
+		}
+		for k, v := range variant.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(variant.Status)
+		if r.Method != http.MethodHead {
+			_, err = w.Write(body)
+		}
+		return true, err
+	}
+	return false, nil
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package record
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/cpendery/wock/model"
+	"golang.org/x/sys/unix"
+)
+
+// CheckOwner makes sure the user owns the directory they're recording into
+func CheckOwner(dir string, user model.User) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("unable to check the owner of %s: %w", dir, err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("unable to check the owner of %s", dir)
+	}
+	if user.Uid != 0 && int(stat.Uid) != user.Uid {
+		return fmt.Errorf("unable to record into %s as it isn't owned by user %d", dir, user.Uid)
+	}
+	return nil
+}
+
+// asUser runs fn with the filesystem credentials of the user, so the files it writes are theirs
+// and it can't write anywhere they couldn't. The credentials only apply to a locked thread which
+// is thrown away afterwards, rather than restored, so they can't leak into the rest of the daemon.
+func asUser(user *model.User, fn func() error) error {
+	if user == nil || user.Uid == os.Geteuid() {
+		return fn()
+	}
+	errs := make(chan error, 1)
+	go func() {
+		// exiting while locked terminates the thread
+		runtime.LockOSThread()
+		if err := setFilesystemUser(*user); err != nil {
+			errs <- fmt.Errorf("unable to record as user %d: %w", user.Uid, err)
+			return
+		}
+		errs <- fn()
+	}()
+	return <-errs
+}
+
+// setFilesystemUser switches the current thread's groups and filesystem ids to the user's, the
+// raw syscalls only affect the calling thread
+func setFilesystemUser(user model.User) error {
+	if err := unix.Setgroups([]int{user.Gid}); err != nil {
+		return err
+	}
+	if err := unix.Setfsgid(user.Gid); err != nil {
+		return err
+	}
+	if err := unix.Setfsuid(user.Uid); err != nil {
+		return err
+	}
+	// setfsuid and setfsgid otherwise report failures by leaving the ids unchanged
+	if gid, _ := unix.SetfsgidRetGid(-1); gid != user.Gid {
+		return fmt.Errorf("filesystem group is %d", gid)
+	}
+	if uid, _ := unix.SetfsuidRetUid(-1); uid != user.Uid {
+		return fmt.Errorf("filesystem user is %d", uid)
+	}
+	return nil
+}
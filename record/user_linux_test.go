@@ -0,0 +1,87 @@
+//go:build linux
+
+package record
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cpendery/wock/model"
+)
+
+// recordResponse records a response for the path into the directory as the user
+func recordResponse(t *testing.T, dir string, user *model.User, path string) error {
+	t.Helper()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("recorded")),
+		Request:    httptest.NewRequest(http.MethodGet, path, nil),
+	}
+	if err := Record(dir, user, resp); err != nil {
+		return err
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("unable to read the recorded body: %v", err)
+	}
+	return resp.Body.Close()
+}
+
+func TestRecordAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("recording as another user needs root")
+	}
+	nobody := model.User{Uid: 65534, Gid: 65534}
+	dir := t.TempDir()
+	// let the user reach the directories the test creates
+	if err := os.Chmod(filepath.Dir(dir), 0o755); err != nil {
+		t.Fatalf("unable to open up the test directory: %v", err)
+	}
+	owned := filepath.Join(dir, "owned")
+	if err := os.Mkdir(owned, 0o755); err != nil {
+		t.Fatalf("unable to create directory: %v", err)
+	}
+	if err := os.Chown(owned, nobody.Uid, nobody.Gid); err != nil {
+		t.Fatalf("unable to chown directory: %v", err)
+	}
+
+	if err := CheckOwner(owned, nobody); err != nil {
+		t.Errorf("expected the user to own %s: %v", owned, err)
+	}
+	if err := CheckOwner(dir, nobody); err == nil {
+		t.Errorf("expected the user not to own %s", dir)
+	}
+	if err := CheckOwner(owned, model.User{}); err != nil {
+		t.Errorf("expected root to record anywhere: %v", err)
+	}
+
+	if err := recordResponse(t, owned, &nobody, "/users/1"); err != nil {
+		t.Fatalf("unable to record: %v", err)
+	}
+	for _, name := range []string{"users", "users/1", "users/1" + MetadataSuffix} {
+		info, err := os.Stat(filepath.Join(owned, name))
+		if err != nil {
+			t.Fatalf("expected %s to be recorded: %v", name, err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); int(stat.Uid) != nobody.Uid || int(stat.Gid) != nobody.Gid {
+			t.Errorf("expected %s to be owned by %d:%d, got %d:%d", name, nobody.Uid, nobody.Gid, stat.Uid, stat.Gid)
+		}
+	}
+
+	if err := recordResponse(t, dir, &nobody, "/users/1"); err == nil {
+		t.Error("expected recording into a directory the user can't write to to fail")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read %s: %v", dir, err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected nothing to be recorded outside of the user's directory, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package record
+
+import (
+	"errors"
+	"os"
+
+	"github.com/cpendery/wock/model"
+)
+
+var errRecordAsUser = errors.New("recording as another user is only supported on linux, start the daemon with --rootless to record")
+
+// CheckOwner makes sure the user owns the directory they're recording into
+func CheckOwner(dir string, user model.User) error {
+	if user.Uid == os.Geteuid() {
+		return nil
+	}
+	return errRecordAsUser
+}
+
+func asUser(user *model.User, fn func() error) error {
+	if user == nil || user.Uid == os.Geteuid() {
+		return fn()
+	}
+	return errRecordAsUser
+}
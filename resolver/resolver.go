@@ -0,0 +1,250 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	resolvConfFile = "/etc/resolv.conf"
+	// systemdResolvConfFile lists the upstream nameservers behind systemd-resolved's loopback stub
+	systemdResolvConfFile = "/run/systemd/resolve/resolv.conf"
+	queryTimeout          = 3 * time.Second
+	maxMessageSize        = 65535
+	// truncatedFlag is the TC bit in the flags of a dns header
+	truncatedFlag = 0x02
+)
+
+var (
+	// fallbackNameservers are used when the system doesn't configure a nameserver
+	// that can be queried directly (e.g. windows or a loopback stub resolver that
+	// would answer from the hosts file wock edits)
+	fallbackNameservers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+	ErrNoAddresses = errors.New("no addresses found")
+)
+
+// Nameservers returns the system's upstream nameservers, skipping loopback stub resolvers in favor
+// of the nameservers systemd-resolved forwards to, so split and corporate dns keep working
+func Nameservers() []string {
+	for _, file := range []string{resolvConfFile, systemdResolvConfFile} {
+		if servers := readNameservers(file); len(servers) != 0 {
+			return servers
+		}
+	}
+	return fallbackNameservers
+}
+
+func readNameservers(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		ip := net.ParseIP(fields[1])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(ip.String(), "53"))
+	}
+	return servers
+}
+
+func query(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, error) {
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack dns query: %w", err)
+	}
+	raw, err := exchange(ctx, server, packed)
+	if err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(raw); err != nil {
+		return nil, fmt.Errorf("invalid dns response from %s: %w", server, err)
+	}
+	if resp.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("nameserver %s responded with %s", server, resp.Header.RCode)
+	}
+	var ips []net.IP
+	for _, answer := range resp.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		}
+	}
+	return ips, nil
+}
+
+// LookupIP resolves the host by querying upstream nameservers directly, bypassing the
+// hosts file so that wocked hosts resolve to their real addresses
+func LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	name, err := dnsmessage.NewName(fqdn(host))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %s: %w", host, err)
+	}
+	var lastErr error = ErrNoAddresses
+	for _, server := range Nameservers() {
+		var ips []net.IP
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			found, err := query(ctx, server, name, qtype)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			ips = append(ips, found...)
+		}
+		if len(ips) != 0 {
+			return ips, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to resolve %s: %w", host, lastErr)
+}
+
+// DialContext dials the address after resolving its host with LookupIP
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// Exchange forwards a raw dns query to the first nameserver that answers it
+func Exchange(ctx context.Context, servers []string, query []byte) ([]byte, error) {
+	var lastErr error = errors.New("no nameservers configured")
+	for _, server := range servers {
+		resp, err := exchange(ctx, server, query)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchange sends the query over udp, retrying over tcp when the answer is truncated
+func exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	resp, err := exchangeUDP(ctx, server, query)
+	if err != nil {
+		return nil, err
+	}
+	if resp[2]&truncatedFlag != 0 {
+		return exchangeTCP(ctx, server, query)
+	}
+	return resp, nil
+}
+
+func dialNameserver(ctx context.Context, network string, server string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial nameserver %s: %w", server, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(queryTimeout)
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+func exchangeUDP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, errors.New("invalid dns query")
+	}
+	conn, err := dialNameserver(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf("unable to write dns query: %w", err)
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read dns response: %w", err)
+		}
+		// responses to other queries, e.g. late answers to an earlier attempt, are skipped
+		if n >= 12 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// exchangeTCP sends the query over tcp, where messages are prefixed with their length
+func exchangeTCP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	conn, err := dialNameserver(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, fmt.Errorf("unable to write dns query: %w", err)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, fmt.Errorf("unable to read dns response: %w", err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("unable to read dns response: %w", err)
+	}
+	if len(resp) < 12 {
+		return nil, errors.New("invalid dns response")
+	}
+	return resp, nil
+}
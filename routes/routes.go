@@ -0,0 +1,234 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ManifestName = "wock.routes.yaml"
+
+	wildcardParam = "*"
+)
+
+type Manifest struct {
+	Routes []Route `yaml:"routes"`
+}
+
+type Route struct {
+	Method  string            `yaml:"method,omitempty"`
+	Path    string            `yaml:"path"`
+	Status  int               `yaml:"status,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	File    string            `yaml:"file,omitempty"`
+
+	segments []string
+	template *template.Template
+}
+
+// TemplateData is the data available to route body templates
+type TemplateData struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   url.Values
+	Headers http.Header
+}
+
+type cachedManifest struct {
+	modTime time.Time
+	// files are the modification times of the files routes read their bodies from, zero for
+	// files that didn't exist
+	files    map[string]time.Time
+	manifest *Manifest
+	err      error
+}
+
+func (c cachedManifest) isStale(modTime time.Time) bool {
+	if !c.modTime.Equal(modTime) {
+		return true
+	}
+	for file, fileModTime := range c.files {
+		if !fileModTime.Equal(modifiedAt(file)) {
+			return true
+		}
+	}
+	return false
+}
+
+// modifiedAt returns when the file was last modified, or the zero time if it can't be read
+func modifiedAt(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+var (
+	cache     = map[string]cachedManifest{}
+	cacheLock sync.Mutex
+)
+
+// Load returns the routes manifest in the directory, or nil if the directory doesn't have one.
+// Manifests are cached until the manifest file or a file a route serves is modified.
+func Load(dir string) (*Manifest, error) {
+	manifestPath := filepath.Join(dir, ManifestName)
+	info, err := os.Stat(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to check routes manifest: %w", err)
+	}
+
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if cached, ok := cache[manifestPath]; ok && !cached.isStale(info.ModTime()) {
+		return cached.manifest, cached.err
+	}
+	files := map[string]time.Time{}
+	manifest, err := parse(dir, manifestPath, files)
+	cache[manifestPath] = cachedManifest{modTime: info.ModTime(), files: files, manifest: manifest, err: err}
+	return manifest, err
+}
+
+// parse reads the manifest, recording the modification times of the files its routes read in files
+func parse(dir string, manifestPath string, files map[string]time.Time) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read routes manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal routes manifest: %w", err)
+	}
+	for i := range manifest.Routes {
+		route := &manifest.Routes[i]
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("route path '%s' must start with '/'", route.Path)
+		}
+		if route.Body != "" && route.File != "" {
+			return nil, fmt.Errorf("route %s %s can't have both a body and a file", route.Method, route.Path)
+		}
+		route.segments = splitPath(route.Path)
+		for j, segment := range route.segments {
+			if segment == wildcardParam && j != len(route.segments)-1 {
+				return nil, fmt.Errorf("route path '%s' can only have a wildcard as its last segment", route.Path)
+			}
+		}
+		body := route.Body
+		if route.File != "" {
+			// the modification time is taken before reading so an edit during the read isn't missed
+			files[route.filePath(dir)] = modifiedAt(route.filePath(dir))
+			fileData, err := os.ReadFile(route.filePath(dir))
+			if err != nil {
+				return nil, fmt.Errorf("unable to read file for route %s: %w", route.Path, err)
+			}
+			body = string(fileData)
+		}
+		tmpl, err := template.New(route.Path).Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for route %s: %w", route.Path, err)
+		}
+		route.template = tmpl
+	}
+	return &manifest, nil
+}
+
+func splitPath(p string) []string {
+	trimmed := strings.Trim(p, "/")
+	if trimmed == "" {
+		return []string{}
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func (r *Route) filePath(dir string) string {
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.File)))
+}
+
+func (r *Route) match(method string, segments []string) (map[string]string, bool) {
+	if r.Method != "" && r.Method != "*" && !strings.EqualFold(r.Method, method) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if segment == wildcardParam {
+			params[wildcardParam] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(segment, ":") {
+			params[segment[1:]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(r.segments) == len(segments)
+}
+
+// Match finds the first route matching the request along with its path params
+func (m *Manifest) Match(r *http.Request) (*Route, map[string]string) {
+	segments := splitPath(r.URL.Path)
+	for i := range m.Routes {
+		if params, ok := m.Routes[i].match(r.Method, segments); ok {
+			return &m.Routes[i], params
+		}
+	}
+	return nil, nil
+}
+
+// Serve writes the route's response, rendering its body with the request's values
+func (r *Route) Serve(w http.ResponseWriter, req *http.Request, params map[string]string) error {
+	var body bytes.Buffer
+	if err := r.template.Execute(&body, TemplateData{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Params:  params,
+		Query:   req.URL.Query(),
+		Headers: req.Header,
+	}); err != nil {
+		http.Error(w, "unable to render route", http.StatusInternalServerError)
+		return fmt.Errorf("unable to render route %s: %w", r.Path, err)
+	}
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		contentType := http.DetectContentType(body.Bytes())
+		if r.File != "" {
+			if byExt := mime.TypeByExtension(filepath.Ext(r.File)); byExt != "" {
+				contentType = byExt
+			}
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if req.Method != http.MethodHead {
+		_, err := body.WriteTo(w)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes the file into the directory, setting its modification time so reloads are
+// detected regardless of the filesystem's timestamp resolution
+func writeFile(t *testing.T, dir string, name string, data string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("unable to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("unable to write %s: %v", name, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("unable to set modification time of %s: %v", name, err)
+	}
+}
+
+func serveRoute(t *testing.T, manifest *Manifest, method string, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("X-User", "ada")
+	route, params := manifest.Match(req)
+	if route == nil {
+		t.Fatalf("expected a route to match %s %s", method, target)
+	}
+	rec := httptest.NewRecorder()
+	if err := route.Serve(rec, req, params); err != nil {
+		t.Fatalf("unable to serve %s %s: %v", method, target, err)
+	}
+	return rec
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{name: "yaml", manifest: "routes: [\n"},
+		{name: "relative path", manifest: "routes:\n  - path: users\n"},
+		{name: "body and file", manifest: "routes:\n  - path: /users\n    body: hi\n    file: users.json\n"},
+		{name: "inner wildcard", manifest: "routes:\n  - path: /files/*/raw\n"},
+		{name: "missing file", manifest: "routes:\n  - path: /users\n    file: missing.json\n"},
+		{name: "template", manifest: "routes:\n  - path: /users\n    body: '{{ .Params'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, ManifestName, tt.manifest, time.Now())
+			if _, err := Load(dir); err == nil {
+				t.Error("expected an error loading the manifest")
+			}
+		})
+	}
+}
+
+func TestLoadWithoutManifest(t *testing.T) {
+	manifest, err := Load(t.TempDir())
+	if err != nil || manifest != nil {
+		t.Errorf("expected no manifest and no error, got %v, %v", manifest, err)
+	}
+}
+
+func TestMatchAndServe(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "site")
+	writeFile(t, dir, ManifestName, `routes:
+  - method: POST
+    path: /login
+    status: 401
+    headers:
+      Content-Type: application/json
+    body: '{"error":"denied"}'
+  - method: GET
+    path: /users/:id
+    body: 'user {{ .Params.id }} for {{ index .Headers "X-User" 0 }}'
+  - path: /users/:id/posts/:post
+    body: '{{ .Method }} post {{ .Params.post }} of {{ .Params.id }}'
+  - method: GET
+    path: /search
+    body: 'searching {{ .Query.Get "q" }}'
+  - method: GET
+    path: /files/*
+    body: 'file {{ index .Params "*" }}'
+  - method: GET
+    path: /profile
+    file: ../fixtures/profile.json
+  - method: GET
+    path: /
+    body: root
+`, time.Now())
+	writeFile(t, dir, "fixtures/profile.json", `{"name":"ada"}`, time.Now())
+	// routes can't read files outside the served directory, so ../ stays inside it
+	writeFile(t, root, "fixtures/profile.json", `{"name":"outside"}`, time.Now())
+	manifest, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unable to load manifest: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		wantStatus      int
+		wantBody        string
+		wantContentType string
+	}{
+		{name: "status and headers", method: http.MethodPost, target: "/login", wantStatus: http.StatusUnauthorized, wantBody: `{"error":"denied"}`, wantContentType: "application/json"},
+		{name: "path param", method: http.MethodGet, target: "/users/42", wantStatus: http.StatusOK, wantBody: "user 42 for ada", wantContentType: "text/plain; charset=utf-8"},
+		{name: "method case", method: "get", target: "/users/42", wantStatus: http.StatusOK, wantBody: "user 42 for ada"},
+		{name: "any method", method: http.MethodDelete, target: "/users/42/posts/7", wantStatus: http.StatusOK, wantBody: "DELETE post 7 of 42"},
+		{name: "query", method: http.MethodGet, target: "/search?q=wock", wantStatus: http.StatusOK, wantBody: "searching wock"},
+		{name: "wildcard", method: http.MethodGet, target: "/files/a/b/c.txt", wantStatus: http.StatusOK, wantBody: "file a/b/c.txt"},
+		{name: "empty wildcard", method: http.MethodGet, target: "/files/", wantStatus: http.StatusOK, wantBody: "file "},
+		{name: "wildcard parent", method: http.MethodGet, target: "/files", wantStatus: http.StatusOK, wantBody: "file "},
+		{name: "file confined to the directory", method: http.MethodGet, target: "/profile", wantStatus: http.StatusOK, wantBody: `{"name":"ada"}`, wantContentType: "application/json"},
+		{name: "root", method: http.MethodGet, target: "/", wantStatus: http.StatusOK, wantBody: "root"},
+		{name: "head", method: http.MethodHead, target: "/users/42/posts/7", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRoute(t, manifest, tt.method, tt.target)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got)
+			}
+			if got := rec.Header().Get("Content-Type"); tt.wantContentType != "" && got != tt.wantContentType {
+				t.Errorf("expected content type %q, got %q", tt.wantContentType, got)
+			}
+		})
+	}
+
+	for _, unmatched := range []struct{ method, target string }{
+		{http.MethodGet, "/login"},
+		{http.MethodPost, "/users/42"},
+		{http.MethodHead, "/"},
+		{http.MethodGet, "/users"},
+		{http.MethodGet, "/users/42/posts"},
+		{http.MethodGet, "/missing"},
+	} {
+		if route, _ := manifest.Match(httptest.NewRequest(unmatched.method, unmatched.target, nil)); route != nil {
+			t.Errorf("expected %s %s not to match, got %s %s", unmatched.method, unmatched.target, route.Method, route.Path)
+		}
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ManifestName, `routes:
+  - path: /users/me
+    body: me
+  - path: /users/:id
+    body: '{{ .Params.id }}'
+`, time.Now())
+	manifest, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unable to load manifest: %v", err)
+	}
+	for target, want := range map[string]string{"/users/me": "me", "/users/7": "7"} {
+		if got := serveRoute(t, manifest, http.MethodGet, target).Body.String(); got != want {
+			t.Errorf("expected %s to serve %q, got %q", target, want, got)
+		}
+	}
+}
+
+func TestLoadReloads(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name string
+		// update changes the directory after the first load, returning the body now expected
+		update func(t *testing.T, dir string) string
+	}{
+		{
+			name:   "unchanged",
+			update: func(t *testing.T, dir string) string { return "v1" },
+		},
+		{
+			name: "manifest modified",
+			update: func(t *testing.T, dir string) string {
+				writeFile(t, dir, ManifestName, "routes:\n  - path: /\n    body: v2\n", start.Add(time.Minute))
+				return "v2"
+			},
+		},
+		{
+			name: "route file modified",
+			update: func(t *testing.T, dir string) string {
+				writeFile(t, dir, "body.txt", "v2", start.Add(time.Minute))
+				return "v2"
+			},
+		},
+		{
+			name: "route file edited without a new modification time",
+			update: func(t *testing.T, dir string) string {
+				writeFile(t, dir, "body.txt", "v2", start)
+				return "v1"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifest := "routes:\n  - path: /\n    body: v1\n"
+			if strings.Contains(tt.name, "route file") {
+				manifest = "routes:\n  - path: /\n    file: body.txt\n"
+				writeFile(t, dir, "body.txt", "v1", start)
+			}
+			writeFile(t, dir, ManifestName, manifest, start)
+			first, err := Load(dir)
+			if err != nil {
+				t.Fatalf("unable to load manifest: %v", err)
+			}
+			want := tt.update(t, dir)
+			second, err := Load(dir)
+			if err != nil {
+				t.Fatalf("unable to reload manifest: %v", err)
+			}
+			if reloaded := first != second; reloaded != (want != "v1") {
+				t.Errorf("expected reloaded %v, got %v", want != "v1", reloaded)
+			}
+			if got := serveRoute(t, second, http.MethodGet, "/").Body.String(); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestLoadCachesErrors(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeFile(t, dir, ManifestName, "routes:\n  - path: users\n", start)
+	if _, err := Load(dir); err == nil {
+		t.Fatal("expected an error loading the manifest")
+	}
+	if _, err := Load(dir); err == nil {
+		t.Fatal("expected the cached error")
+	}
+	writeFile(t, dir, ManifestName, "routes:\n  - path: /users\n", start.Add(time.Minute))
+	if _, err := Load(dir); err != nil {
+		t.Errorf("expected the fixed manifest to load, got %v", err)
+	}
+}
@@ -0,0 +1,378 @@
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/config"
+	"github.com/cpendery/wock/fault"
+	"github.com/cpendery/wock/har"
+	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/record"
+	"github.com/cpendery/wock/resolver"
+	"github.com/cpendery/wock/routes"
+	"github.com/cpendery/wock/throttle"
+)
+
+const (
+	// indexFile is what the file server serves for a directory
+	indexFile = "index.html"
+)
+
+var (
+	passthroughTransport = &http.Transport{
+		DialContext:         resolver.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     http.DefaultTransport.(*http.Transport).IdleConnTimeout,
+		TLSHandshakeTimeout: http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout,
+	}
+	passthroughProxy = newPassthroughProxy(nil)
+)
+
+func newPassthroughProxy(modifyResponse func(*http.Response) error) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = "http"
+			if r.In.TLS != nil {
+				r.Out.URL.Scheme = "https"
+			}
+			// the inbound port is wock's listener, the real host is reached on the scheme's default port
+			host := r.In.Host
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+			r.Out.URL.Host = host
+			r.Out.Host = host
+			r.SetXForwarded()
+		},
+		Transport:      passthroughTransport,
+		ModifyResponse: modifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("failed to proxy request to upstream", slog.String("host", r.Host), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+func newRecordingProxy(dir string, user *model.User) *httputil.ReverseProxy {
+	proxy := newPassthroughProxy(func(resp *http.Response) error {
+		if err := record.Record(dir, user, resp); err != nil {
+			slog.Error("failed to record response", slog.String("host", resp.Request.Host), slog.String("path", resp.Request.URL.Path), slog.String("error", err.Error()))
+		}
+		return nil
+	})
+	rewrite := proxy.Rewrite
+	proxy.Rewrite = func(r *httputil.ProxyRequest) {
+		rewrite(r)
+		// let the transport negotiate compression so recorded bodies are stored decoded
+		r.Out.Header.Del("Accept-Encoding")
+	}
+	return proxy
+}
+
+// LookupFunc finds the wocked host serving a request, along with the archive a har session is
+// replayed from
+type LookupFunc func(host string) (model.MockedHost, *har.Archive, bool)
+
+// Handler serves requests for wocked hosts, minting their certificates on demand. It's shared by
+// the daemon and wocktest, which keep track of the wocked hosts themselves.
+type Handler struct {
+	Issuer *cert.Issuer
+	Lookup LookupFunc
+	// Served is called after every request to a wocked host, when set
+	Served   func(host string, request model.RequestEvent)
+	requests sync.Map
+	// upstreams caches the proxy of every wocked host served from an upstream
+	upstreams sync.Map
+}
+
+type upstreamProxy struct {
+	upstream string
+	proxy    *httputil.ReverseProxy
+}
+
+// Register prepares to serve the wocked host, building its upstream proxy up front so an invalid
+// upstream is reported when the host is wocked rather than on every request
+func (h *Handler) Register(mockedHost model.MockedHost) error {
+	if mockedHost.Upstream == "" {
+		h.upstreams.Delete(mockedHost.Host)
+		return nil
+	}
+	proxy, err := newUpstreamProxy(mockedHost.Upstream)
+	if err != nil {
+		return fmt.Errorf("invalid upstream %s: %w", mockedHost.Upstream, err)
+	}
+	h.upstreams.Store(mockedHost.Host, &upstreamProxy{upstream: mockedHost.Upstream, proxy: proxy})
+	return nil
+}
+
+// Unregister drops what was prepared to serve the host once it's no longer wocked
+func (h *Handler) Unregister(host string) {
+	h.upstreams.Delete(host)
+}
+
+func (h *Handler) upstreamProxy(mockedHost model.MockedHost) (*httputil.ReverseProxy, error) {
+	if cached, ok := h.upstreams.Load(mockedHost.Host); ok && cached.(*upstreamProxy).upstream == mockedHost.Upstream {
+		return cached.(*upstreamProxy).proxy, nil
+	}
+	if err := h.Register(mockedHost); err != nil {
+		return nil, err
+	}
+	cached, _ := h.upstreams.Load(mockedHost.Host)
+	return cached.(*upstreamProxy).proxy, nil
+}
+
+type sourceKey struct{}
+
+// setSource records what answered the request, e.g. the file served, for the request's event
+func setSource(r *http.Request, source string) {
+	if s, ok := r.Context().Value(sourceKey{}).(*string); ok {
+		*s = source
+	}
+}
+
+// statusWriter captures the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(strings.Split(r.Host, ":")[0])
+	mockedHost, archive, ok := h.Lookup(host)
+	if !ok {
+		slog.Debug("received request for host that isn't wocked", slog.String("host", host))
+		http.NotFound(w, r)
+		return
+	}
+	h.requestCount(mockedHost.Host).Add(1)
+	if h.Served != nil {
+		start := time.Now()
+		var source string
+		r = r.WithContext(context.WithValue(r.Context(), sourceKey{}, &source))
+		sw := &statusWriter{ResponseWriter: w}
+		w = sw
+		defer func() {
+			request := model.RequestEvent{
+				Remote:  r.RemoteAddr,
+				Method:  r.Method,
+				Path:    r.URL.RequestURI(),
+				Proto:   r.Proto,
+				Status:  sw.status,
+				Latency: time.Since(start),
+				Bytes:   sw.bytes,
+				Source:  source,
+			}
+			if remote, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				request.Remote = remote
+			}
+			if r.TLS != nil {
+				request.TLS = tls.VersionName(r.TLS.Version)
+			}
+			h.Served(mockedHost.Host, request)
+		}()
+	}
+	w, err := throttle.Apply(w, r, mockedHost.Throttle)
+	if err != nil {
+		slog.Debug("client went away while throttled", slog.String("host", host), slog.String("error", err.Error()))
+		return
+	}
+	fault.Wrap(mockedHost.Faults, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mockedHost.Session != "" {
+			serveHarSession(mockedHost, archive, w, r)
+			return
+		}
+		h.serveMockedHost(mockedHost, w, r)
+	})).ServeHTTP(w, r)
+}
+
+// GetCertificate picks the certificate for the wocked host named by SNI, wildcard hosts share
+// a single wildcard certificate
+func (h *Handler) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.ToLower(hello.ServerName)
+	mockedHost, _, ok := h.Lookup(host)
+	if !ok {
+		return nil, fmt.Errorf("host %s is not being wocked", host)
+	}
+	return h.Issuer.Certificate(mockedHost.Host)
+}
+
+// Requests returns how many requests have been served for the wocked host
+func (h *Handler) Requests(host string) uint64 {
+	return h.requestCount(host).Load()
+}
+
+func (h *Handler) requestCount(host string) *atomic.Uint64 {
+	count, _ := h.requests.LoadOrStore(host, &atomic.Uint64{})
+	return count.(*atomic.Uint64)
+}
+
+// Find returns the wocked host matching the host exactly or, failing that, through a wildcard
+func Find(mockedHosts map[string]model.MockedHost, host string) (model.MockedHost, bool) {
+	if mockedHost, ok := mockedHosts[host]; ok {
+		return mockedHost, true
+	}
+	for _, mockedHost := range mockedHosts {
+		if hosts.Matches(mockedHost.Host, host) {
+			return mockedHost, true
+		}
+	}
+	return model.MockedHost{}, false
+}
+
+func serveHarSession(mockedHost model.MockedHost, archive *har.Archive, w http.ResponseWriter, r *http.Request) {
+	if archive == nil {
+		http.NotFound(w, r)
+		return
+	}
+	setSource(r, mockedHost.Session)
+	served, err := archive.Serve(w, r)
+	if err != nil {
+		slog.Error("failed to replay har entry", slog.String("host", mockedHost.Host), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		return
+	}
+	if !served {
+		http.NotFound(w, r)
+	}
+}
+
+func newUpstreamProxy(upstream string) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("upstreams have to be http or https urls")
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			slog.Error("failed to proxy request to upstream", slog.String("upstream", upstream), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}, nil
+}
+
+func (h *Handler) serveMockedHost(mockedHost model.MockedHost, w http.ResponseWriter, r *http.Request) {
+	if mockedHost.Recording {
+		setSource(r, "recording to "+mockedHost.Directory)
+		newRecordingProxy(mockedHost.Directory, mockedHost.RecordAs).ServeHTTP(w, r)
+		return
+	}
+	if mockedHost.Upstream != "" {
+		proxy, err := h.upstreamProxy(mockedHost)
+		if err != nil {
+			slog.Error("invalid upstream", slog.String("upstream", mockedHost.Upstream), slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		setSource(r, mockedHost.Upstream)
+		proxy.ServeHTTP(w, r)
+		return
+	}
+	manifest, err := routes.Load(mockedHost.Directory)
+	if err != nil {
+		slog.Error("invalid routes manifest", slog.String("host", mockedHost.Host), slog.String("error", err.Error()))
+	} else if manifest != nil {
+		if route, params := manifest.Match(r); route != nil {
+			setSource(r, fmt.Sprintf("route %s %s", route.Method, route.Path))
+			if err := route.Serve(w, r, params); err != nil {
+				slog.Error("failed to serve route", slog.String("host", mockedHost.Host), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			}
+			return
+		}
+	}
+	setSource(r, "recorded response in "+mockedHost.Directory)
+	if replayed, err := record.Replay(mockedHost.Directory, w, r); err != nil {
+		slog.Error("failed to replay recorded response", slog.String("host", mockedHost.Host), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		return
+	} else if replayed {
+		return
+	}
+	if mockedHost.SPAFallback != "" && isHistoryNavigation(r) && !fileExists(mockedHost.Directory, r.URL.Path) {
+		fallback, err := config.FallbackPath(mockedHost.Directory, mockedHost.SPAFallback)
+		if err != nil {
+			slog.Error("invalid spa fallback", slog.String("host", mockedHost.Host), slog.String("error", err.Error()))
+			http.NotFound(w, r)
+			return
+		}
+		setSource(r, fallback)
+		http.ServeFile(w, r, fallback)
+		return
+	}
+	if mockedHost.Passthrough && !fileExists(mockedHost.Directory, r.URL.Path) {
+		slog.Debug("passing request through to upstream", slog.String("host", mockedHost.Host), slog.String("path", r.URL.Path))
+		setSource(r, "passthrough")
+		passthroughProxy.ServeHTTP(w, r)
+		return
+	}
+	setSource(r, filepath.Join(mockedHost.Directory, filepath.FromSlash(path.Clean("/"+r.URL.Path))))
+	server := http.FileServer(http.Dir(mockedHost.Directory))
+	server.ServeHTTP(w, r)
+}
+
+// fileExists reports whether the directory has a file to serve for the path, where a directory
+// only counts when it has an index.html, since a generated listing isn't what the real host serves
+func fileExists(dir string, urlPath string) bool {
+	name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+urlPath)))
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() {
+		info, err = os.Stat(filepath.Join(name, indexFile))
+	}
+	return err == nil && info.Mode().IsRegular()
+}
+
+// isHistoryNavigation reports whether the request looks like a client-side route being
+// loaded by the browser rather than a request for an asset. Routes can look like files (e.g.
+// /users/john.doe), so only the Accept header browsers send when navigating is checked.
+func isHistoryNavigation(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
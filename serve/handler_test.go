@@ -0,0 +1,84 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cpendery/wock/model"
+)
+
+const navigationAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func writeSite(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("unable to create %s: %v", filepath.Dir(file), err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatalf("unable to write %s: %v", file, err)
+		}
+	}
+}
+
+func TestServeMockedHostSPA(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "site")
+	writeSite(t, root, map[string]string{
+		"secret.html":          "secret",
+		"site/index.html":      "app shell",
+		"site/assets/app.js":   "console.log('app')",
+		"site/docs/index.html": "docs",
+		"site/empty/.keep":     "",
+	})
+
+	tests := []struct {
+		name       string
+		fallback   string
+		method     string
+		path       string
+		accept     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "route", fallback: "index.html", path: "/dashboard", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "app shell"},
+		{name: "dotted route", fallback: "index.html", path: "/users/john.doe", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "app shell"},
+		{name: "route with extension", fallback: "index.html", path: "/reports/2024.pdf", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "app shell"},
+		{name: "head route", fallback: "index.html", method: http.MethodHead, path: "/dashboard", accept: navigationAccept, wantStatus: http.StatusOK},
+		{name: "directory without index", fallback: "index.html", path: "/empty/", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "app shell"},
+		{name: "existing file", fallback: "index.html", path: "/assets/app.js", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "console.log('app')"},
+		{name: "existing directory index", fallback: "index.html", path: "/docs/", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "docs"},
+		{name: "missing asset", fallback: "index.html", path: "/assets/missing.js", accept: "*/*", wantStatus: http.StatusNotFound},
+		{name: "missing api call", fallback: "index.html", path: "/api/users", accept: "application/json", wantStatus: http.StatusNotFound},
+		{name: "post", fallback: "index.html", method: http.MethodPost, path: "/dashboard", accept: navigationAccept, wantStatus: http.StatusNotFound},
+		{name: "nested fallback", fallback: "docs/index.html", path: "/guide", accept: navigationAccept, wantStatus: http.StatusOK, wantBody: "docs"},
+		{name: "fallback outside the directory", fallback: "../secret.html", path: "/dashboard", accept: navigationAccept, wantStatus: http.StatusNotFound},
+		{name: "no fallback", path: "/dashboard", accept: navigationAccept, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://app.example.com"+tt.path, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			(&Handler{}).serveMockedHost(model.MockedHost{Host: "app.example.com", Directory: dir, SPAFallback: tt.fallback}, w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if body := w.Body.String(); tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+			if strings.Contains(w.Body.String(), "secret") {
+				t.Errorf("expected nothing outside of %s to be served, got %q", dir, w.Body.String())
+			}
+		})
+	}
+}
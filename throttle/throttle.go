@@ -0,0 +1,206 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpendery/wock/model"
+)
+
+const (
+	latencyRangeSeparator = ".."
+	// bandwidth is enforced by writing in chunks sized to roughly this interval
+	throttleInterval = 50 * time.Millisecond
+)
+
+var (
+	bandwidthUnits = []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"gbps", 1_000_000_000},
+		{"mbps", 1_000_000},
+		{"kbps", 1_000},
+		{"bps", 1},
+	}
+)
+
+// ParseLatency parses a fixed latency (e.g. 200ms) or a random range (e.g. 200ms..1500ms)
+func ParseLatency(latency string) (time.Duration, time.Duration, error) {
+	minLatency, maxLatency, isRange := strings.Cut(latency, latencyRangeSeparator)
+	low, err := time.ParseDuration(strings.TrimSpace(minLatency))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latency '%s': %w", latency, err)
+	}
+	if !isRange {
+		return low, low, nil
+	}
+	high, err := time.ParseDuration(strings.TrimSpace(maxLatency))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latency '%s': %w", latency, err)
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("invalid latency '%s': maximum is less than minimum", latency)
+	}
+	return low, high, nil
+}
+
+// ParseTTFB parses a fixed time to first byte (e.g. 500ms), ranges aren't supported since the
+// first byte is only delayed once per response
+func ParseTTFB(ttfb string) (time.Duration, error) {
+	if strings.Contains(ttfb, latencyRangeSeparator) {
+		return 0, fmt.Errorf("invalid ttfb '%s': ranges aren't supported, use a fixed duration", ttfb)
+	}
+	parsed, err := time.ParseDuration(strings.TrimSpace(ttfb))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttfb '%s': %w", ttfb, err)
+	}
+	if parsed < 0 {
+		return 0, fmt.Errorf("invalid ttfb '%s': it can't be negative", ttfb)
+	}
+	return parsed, nil
+}
+
+// ParseBandwidth parses a throughput in bits per second such as 256kbps or 1.5mbps
+func ParseBandwidth(bandwidth string) (int64, error) {
+	normalized := strings.ToLower(strings.TrimSpace(bandwidth))
+	for _, unit := range bandwidthUnits {
+		if value, ok := strings.CutSuffix(normalized, unit.suffix); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed <= 0 {
+				return 0, fmt.Errorf("invalid bandwidth '%s'", bandwidth)
+			}
+			return int64(parsed * float64(unit.multiplier)), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid bandwidth '%s', expected a unit of bps, kbps, mbps, or gbps", bandwidth)
+}
+
+// Validate checks that the throttle's durations and bandwidth aren't negative and that its latency
+// range isn't inverted
+func Validate(t model.Throttle) error {
+	switch {
+	case t.LatencyMin < 0 || t.TTFB < 0 || t.Bandwidth < 0:
+		return errors.New("throttle latency, ttfb, and bandwidth can't be negative")
+	case t.LatencyMax < t.LatencyMin:
+		return fmt.Errorf("throttle latency maximum %s is less than the minimum %s", t.LatencyMax, t.LatencyMin)
+	}
+	return nil
+}
+
+func FormatBandwidth(bitsPerSecond int64) string {
+	for _, unit := range bandwidthUnits {
+		if bitsPerSecond >= unit.multiplier && bitsPerSecond%unit.multiplier == 0 {
+			return fmt.Sprintf("%d%s", bitsPerSecond/unit.multiplier, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dbps", bitsPerSecond)
+}
+
+func Describe(t model.Throttle) string {
+	var parts []string
+	switch {
+	case t.LatencyMax > t.LatencyMin:
+		parts = append(parts, fmt.Sprintf("latency %s%s%s", t.LatencyMin, latencyRangeSeparator, t.LatencyMax))
+	case t.LatencyMin > 0:
+		parts = append(parts, fmt.Sprintf("latency %s", t.LatencyMin))
+	}
+	if t.TTFB > 0 {
+		parts = append(parts, fmt.Sprintf("ttfb %s", t.TTFB))
+	}
+	if t.Bandwidth > 0 {
+		parts = append(parts, fmt.Sprintf("bandwidth %s", FormatBandwidth(t.Bandwidth)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Apply waits out the configured latency and returns a writer that delays the first byte
+// and limits throughput. An error is returned if the client went away while waiting.
+func Apply(w http.ResponseWriter, r *http.Request, t model.Throttle) (http.ResponseWriter, error) {
+	if !t.Enabled() {
+		return w, nil
+	}
+	latency := t.LatencyMin
+	if t.LatencyMax > t.LatencyMin {
+		latency += time.Duration(rand.Int63n(int64(t.LatencyMax - t.LatencyMin)))
+	}
+	if err := sleep(r.Context(), latency); err != nil {
+		return nil, err
+	}
+	return &writer{ResponseWriter: w, ctx: r.Context(), throttle: t}, nil
+}
+
+type writer struct {
+	http.ResponseWriter
+	ctx       context.Context
+	throttle  model.Throttle
+	firstByte bool
+}
+
+func (w *writer) waitForFirstByte() {
+	if !w.firstByte {
+		w.firstByte = true
+		sleep(w.ctx, w.throttle.TTFB)
+	}
+}
+
+func (w *writer) WriteHeader(statusCode int) {
+	w.waitForFirstByte()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.waitForFirstByte()
+	if w.throttle.Bandwidth <= 0 {
+		return w.ResponseWriter.Write(b)
+	}
+	bytesPerSecond := max(w.throttle.Bandwidth/8, 1)
+	chunkSize := int(max(bytesPerSecond*int64(throttleInterval)/int64(time.Second), 1))
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(written+chunkSize, len(b))]
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+		if err := sleep(w.ctx, time.Duration(int64(n)*int64(time.Second)/bytesPerSecond)); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (w *writer) Flush() {
+	w.waitForFirstByte()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
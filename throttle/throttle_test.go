@@ -0,0 +1,122 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cpendery/wock/model"
+)
+
+func TestParseLatency(t *testing.T) {
+	tests := []struct {
+		latency string
+		wantMin time.Duration
+		wantMax time.Duration
+		wantErr bool
+	}{
+		{latency: "200ms", wantMin: 200 * time.Millisecond, wantMax: 200 * time.Millisecond},
+		{latency: "200ms..1500ms", wantMin: 200 * time.Millisecond, wantMax: 1500 * time.Millisecond},
+		{latency: " 1s .. 2s ", wantMin: time.Second, wantMax: 2 * time.Second},
+		{latency: "1s..1s", wantMin: time.Second, wantMax: time.Second},
+		{latency: "2s..1s", wantErr: true},
+		{latency: "200ms..", wantErr: true},
+		{latency: "..200ms", wantErr: true},
+		{latency: "200", wantErr: true},
+		{latency: "slow", wantErr: true},
+	}
+	for _, tt := range tests {
+		gotMin, gotMax, err := ParseLatency(tt.latency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLatency(%q) returned error %v", tt.latency, err)
+		} else if gotMin != tt.wantMin || gotMax != tt.wantMax {
+			t.Errorf("ParseLatency(%q) = %s, %s, want %s, %s", tt.latency, gotMin, gotMax, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestParseTTFB(t *testing.T) {
+	tests := []struct {
+		ttfb    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{ttfb: "500ms", want: 500 * time.Millisecond},
+		{ttfb: " 2s ", want: 2 * time.Second},
+		{ttfb: "0s", want: 0},
+		{ttfb: "200ms..1500ms", wantErr: true},
+		{ttfb: "1s..1s", wantErr: true},
+		{ttfb: "-1s", wantErr: true},
+		{ttfb: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTTFB(tt.ttfb)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTTFB(%q) returned error %v", tt.ttfb, err)
+		} else if got != tt.want {
+			t.Errorf("ParseTTFB(%q) = %s, want %s", tt.ttfb, got, tt.want)
+		}
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		bandwidth string
+		want      int64
+		wantErr   bool
+	}{
+		{bandwidth: "56bps", want: 56},
+		{bandwidth: "256kbps", want: 256_000},
+		{bandwidth: "1.5mbps", want: 1_500_000},
+		{bandwidth: " 1GBPS ", want: 1_000_000_000},
+		{bandwidth: "0kbps", wantErr: true},
+		{bandwidth: "-1mbps", wantErr: true},
+		{bandwidth: "fastmbps", wantErr: true},
+		{bandwidth: "256", wantErr: true},
+		{bandwidth: "256kb", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBandwidth(tt.bandwidth)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBandwidth(%q) returned error %v", tt.bandwidth, err)
+		} else if got != tt.want {
+			t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.bandwidth, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBandwidth(t *testing.T) {
+	for bandwidth, want := range map[int64]string{
+		56:            "56bps",
+		256_000:       "256kbps",
+		1_500_000:     "1500kbps",
+		2_000_000_000: "2gbps",
+	} {
+		if got := FormatBandwidth(bandwidth); got != want {
+			t.Errorf("FormatBandwidth(%d) = %s, want %s", bandwidth, got, want)
+		}
+		if parsed, err := ParseBandwidth(FormatBandwidth(bandwidth)); err != nil || parsed != bandwidth {
+			t.Errorf("expected %s to parse back to %d, got %d, %v", want, bandwidth, parsed, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle model.Throttle
+		wantErr  bool
+	}{
+		{name: "empty", throttle: model.Throttle{}},
+		{name: "fixed latency", throttle: model.Throttle{LatencyMin: time.Second, LatencyMax: time.Second}},
+		{name: "latency range", throttle: model.Throttle{LatencyMin: time.Second, LatencyMax: 2 * time.Second, TTFB: time.Second, Bandwidth: 1000}},
+		{name: "inverted range", throttle: model.Throttle{LatencyMin: 2 * time.Second, LatencyMax: time.Second}, wantErr: true},
+		{name: "negative latency", throttle: model.Throttle{LatencyMin: -time.Second, LatencyMax: time.Second}, wantErr: true},
+		{name: "negative ttfb", throttle: model.Throttle{TTFB: -time.Second}, wantErr: true},
+		{name: "negative bandwidth", throttle: model.Throttle{Bandwidth: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.throttle); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate returned error %v", tt.name, err)
+		}
+	}
+}
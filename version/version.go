@@ -0,0 +1,16 @@
+package version
+
+import "runtime/debug"
+
+// Version is set at build time with -ldflags "-X github.com/cpendery/wock/version.Version=<version>"
+var Version = ""
+
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
@@ -0,0 +1,168 @@
+// Package wocktest runs wock's serving engine inside a test process, without the daemon, root, or
+// the hosts file.
+//
+//	srv := wocktest.New(t, wocktest.Host("api.example.com", "./testdata"))
+//	resp, err := srv.Client().Get("https://api.example.com/users.json")
+//
+// Hosts are only resolved to the server by the client and dialer it returns, and certificates are
+// minted from a throwaway CA that only its tls config trusts.
+package wocktest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cpendery/wock/cert"
+	"github.com/cpendery/wock/config"
+	"github.com/cpendery/wock/har"
+	"github.com/cpendery/wock/hosts"
+	"github.com/cpendery/wock/model"
+	"github.com/cpendery/wock/serve"
+)
+
+const (
+	httpsPort = "443"
+)
+
+// Server serves wocked hosts over http and https on loopback listeners until the test ends
+type Server struct {
+	mockedHosts map[string]model.MockedHost
+	harSessions map[string]*har.Archive
+	handler     serve.Handler
+	serverHttp  *httptest.Server
+	serverHttps *httptest.Server
+	rootCAs     *x509.CertPool
+	client      *http.Client
+}
+
+// Option adds wocked hosts to a server
+type Option func(*Server) error
+
+// Host wocks the host with a directory or an upstream url, the same as `wock [host] [target]`
+func Host(host string, target string) Option {
+	if config.IsUpstream(target) {
+		return Mock(model.MockedHost{Host: host, Upstream: target})
+	}
+	return func(s *Server) error {
+		dir, err := config.IsValidDirectory(target)
+		if err != nil {
+			return err
+		}
+		return Mock(model.MockedHost{Host: host, Directory: *dir})(s)
+	}
+}
+
+// Mock wocks a host with full control over how it's served, e.g. with throttling or faults
+func Mock(mockedHost model.MockedHost) Option {
+	return func(s *Server) error {
+		mockedHost.Host = strings.ToLower(strings.TrimSpace(mockedHost.Host))
+		if !hosts.IsValidHostname(mockedHost.Host) {
+			return fmt.Errorf("provided host '%s' is an invalid hostname", mockedHost.Host)
+		}
+		if err := s.handler.Register(mockedHost); err != nil {
+			return err
+		}
+		s.mockedHosts[mockedHost.Host] = mockedHost
+		return nil
+	}
+}
+
+// HAR wocks every host in a HAR file, serving them from its recorded responses
+func HAR(harFile string, matchBody bool) Option {
+	return func(s *Server) error {
+		archive, err := har.Load(harFile, matchBody)
+		if err != nil {
+			return err
+		}
+		for _, host := range archive.Hosts() {
+			s.mockedHosts[host] = model.MockedHost{Host: host, Session: harFile}
+		}
+		s.harSessions[harFile] = archive
+		return nil
+	}
+}
+
+// New starts a server for the wocked hosts, which is shut down when the test and its subtests end
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	issuer, err := cert.NewEphemeralIssuer()
+	if err != nil {
+		t.Fatalf("wocktest: %v", err)
+	}
+	s := &Server{
+		mockedHosts: make(map[string]model.MockedHost),
+		harSessions: make(map[string]*har.Archive),
+		rootCAs:     x509.NewCertPool(),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			t.Fatalf("wocktest: %v", err)
+		}
+	}
+	s.rootCAs.AddCert(issuer.CA())
+	s.handler.Issuer = issuer
+	s.handler.Lookup = s.lookupHost
+
+	s.serverHttp = httptest.NewServer(&s.handler)
+	s.serverHttps = httptest.NewUnstartedServer(&s.handler)
+	s.serverHttps.EnableHTTP2 = true
+	s.serverHttps.TLS = &tls.Config{GetCertificate: s.handler.GetCertificate}
+	s.serverHttps.StartTLS()
+	transport := &http.Transport{
+		DialContext:       s.DialContext,
+		TLSClientConfig:   s.TLSConfig(),
+		ForceAttemptHTTP2: true,
+	}
+	s.client = &http.Client{Transport: transport}
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		s.serverHttp.Close()
+		s.serverHttps.Close()
+	})
+	return s
+}
+
+func (s *Server) lookupHost(host string) (model.MockedHost, *har.Archive, bool) {
+	mockedHost, ok := serve.Find(s.mockedHosts, host)
+	return mockedHost, s.harSessions[mockedHost.Session], ok
+}
+
+// TLSConfig trusts the certificates the server mints for wocked hosts
+func (s *Server) TLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.rootCAs}
+}
+
+// DialContext dials the server for wocked hosts, https on port 443 and http otherwise, and dials
+// every other host as usual
+func (s *Server) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	if _, ok := serve.Find(s.mockedHosts, strings.ToLower(host)); !ok {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if port == httpsPort {
+		return dialer.DialContext(ctx, "tcp", s.serverHttps.Listener.Addr().String())
+	}
+	return dialer.DialContext(ctx, "tcp", s.serverHttp.Listener.Addr().String())
+}
+
+// Client returns an http client that resolves wocked hosts to the server and trusts its
+// certificates
+func (s *Server) Client() *http.Client {
+	return s.client
+}
+
+// Requests returns how many requests the wocked host has served
+func (s *Server) Requests(host string) uint64 {
+	return s.handler.Requests(strings.ToLower(host))
+}
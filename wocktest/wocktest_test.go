@@ -0,0 +1,90 @@
+package wocktest_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cpendery/wock/wocktest"
+)
+
+func get(t *testing.T, srv *wocktest.Server, url string) (int, string) {
+	t.Helper()
+	resp, err := srv.Client().Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: unable to read body: %v", url, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestServe(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "upstream "+r.URL.Path)
+	}))
+	t.Cleanup(upstream.Close)
+	srv := wocktest.New(t,
+		wocktest.Host("api.example.com", "testdata/site"),
+		wocktest.Host("*.example.org", "testdata/site"),
+		wocktest.Host("dev.example.net", upstream.URL),
+		wocktest.HAR("testdata/recorded.har", false),
+	)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "http file", url: "http://api.example.com/users.json", wantStatus: http.StatusOK, wantBody: `"name":"ada"`},
+		{name: "https file", url: "https://api.example.com/users.json", wantStatus: http.StatusOK, wantBody: `"name":"ada"`},
+		{name: "https index", url: "https://api.example.com/", wantStatus: http.StatusOK, wantBody: "hello from wocktest"},
+		{name: "missing file", url: "https://api.example.com/missing.json", wantStatus: http.StatusNotFound},
+		{name: "http wildcard", url: "http://app.example.org/users.json", wantStatus: http.StatusOK, wantBody: `"name":"ada"`},
+		{name: "https wildcard", url: "https://app.example.org/users.json", wantStatus: http.StatusOK, wantBody: `"name":"ada"`},
+		{name: "https upstream", url: "https://dev.example.net/hello", wantStatus: http.StatusOK, wantBody: "upstream /hello"},
+		{name: "https har", url: "https://har.example.com/status", wantStatus: http.StatusOK, wantBody: `{"ok":true}`},
+		{name: "https har recorded status", url: "https://har.example.com/missing", wantStatus: http.StatusNotFound, wantBody: "recorded not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := get(t, srv, tt.url)
+			if status != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, status)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestServeTrustsOnlyWocktestCA(t *testing.T) {
+	srv := wocktest.New(t, wocktest.Host("api.example.com", "testdata/site"))
+	client := &http.Client{Transport: &http.Transport{DialContext: srv.DialContext}}
+	if _, err := client.Get("https://api.example.com/users.json"); err == nil {
+		t.Fatal("expected a client without the server's tls config to reject its certificate")
+	}
+}
+
+func TestRequests(t *testing.T) {
+	srv := wocktest.New(t,
+		wocktest.Host("api.example.com", "testdata/site"),
+		wocktest.Host("*.example.org", "testdata/site"),
+	)
+	for _, url := range []string{"http://api.example.com/users.json", "https://api.example.com/", "https://app.example.org/users.json"} {
+		get(t, srv, url)
+	}
+	if got := srv.Requests("api.example.com"); got != 2 {
+		t.Errorf("expected 2 requests to api.example.com, got %d", got)
+	}
+	if got := srv.Requests("*.example.org"); got != 1 {
+		t.Errorf("expected 1 request to *.example.org, got %d", got)
+	}
+}